@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/xqdoo00o/funcaptcha"
+)
+
+// ArkoseProvider supplies the arkose_token GPT-4 conversations have to carry.
+type ArkoseProvider interface {
+	Name() string
+	GetToken(ctx context.Context, puid string) (string, error)
+}
+
+var (
+	arkoseProvider     ArkoseProvider
+	arkoseProviderOnce sync.Once
+
+	ArkoseTokenPool = NewTokenPool()
+)
+
+// GetArkose returns the provider selected by ARKOSE_PROVIDER, funcaptcha is the default.
+func GetArkose() ArkoseProvider {
+	arkoseProviderOnce.Do(func() {
+		switch os.Getenv("ARKOSE_PROVIDER") {
+		case arkoseProviderHar:
+			harFile := os.Getenv("ARKOSE_HAR_FILE")
+			if harFile == "" {
+				harFile = defaultArkoseHarFile
+			}
+			arkoseProvider = &HarProvider{Path: harFile}
+		case arkoseProviderSolver:
+			arkoseProvider = &SolverProvider{
+				Url:   os.Getenv("ARKOSE_SOLVER_URL"),
+				Token: os.Getenv("ARKOSE_SOLVER_TOKEN"),
+			}
+		case arkoseProviderPool:
+			arkoseProvider = ArkoseTokenPool
+		default:
+			arkoseProvider = FuncaptchaProvider{}
+		}
+	})
+	return arkoseProvider
+}
+
+func GetArkoseToken(ctx context.Context) (string, error) {
+	token, err := GetArkose().GetToken(ctx, GetPUID())
+	if err == nil && token == "" {
+		err = errors.New(emptyArkoseTokenErrorMessage)
+	}
+	return token, err
+}
+
+func GetArkoseStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"provider": GetArkose().Name(),
+		"pool":     ArkoseTokenPool.Size(),
+	})
+}
+
+type addArkoseTokensRequest struct {
+	Tokens []string `json:"tokens"`
+	// seconds, defaults to ARKOSE_TOKEN_TTL
+	TTL int `json:"ttl"`
+}
+
+// AddArkoseTokens feeds pre-solved tokens into the pool.
+func AddArkoseTokens(c *gin.Context) {
+	var request addArkoseTokensRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Tokens) == 0 {
+		AbortWithParamError(c, http.StatusBadRequest, missingArkoseTokensErrorMessage, "tokens")
+		return
+	}
+
+	ttl := arkoseTokenTTL()
+	if request.TTL > 0 {
+		ttl = time.Duration(request.TTL) * time.Second
+	}
+	for _, token := range request.Tokens {
+		ArkoseTokenPool.Add(token, ttl)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pool": ArkoseTokenPool.Size(),
+	})
+}
+
+func arkoseTokenTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("ARKOSE_TOKEN_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultArkoseTokenTTL
+	}
+	return ttl
+}
+
+// FuncaptchaProvider solves the challenge with the funcaptcha library, which reads chat.openai.com.har from the working directory.
+type FuncaptchaProvider struct{}
+
+func (FuncaptchaProvider) Name() string {
+	return arkoseProviderFuncaptcha
+}
+
+func (FuncaptchaProvider) GetToken(_ context.Context, puid string) (string, error) {
+	return funcaptcha.GetOpenAIToken(puid, GetClientConfig(ProviderArkose).Proxy)
+}
+
+// SolverProvider asks an external solver service, which answers with {"token": "..."} or the bare token.
+type SolverProvider struct {
+	Url   string
+	Token string
+}
+
+func (p *SolverProvider) Name() string {
+	return arkoseProviderSolver
+}
+
+func (p *SolverProvider) GetToken(ctx context.Context, puid string) (string, error) {
+	if p.Url == "" {
+		return "", errors.New(missingArkoseSolverUrlErrorMessage)
+	}
+
+	data, _ := json.Marshal(map[string]string{
+		"public_key": arkoseChatPublicKey,
+		"puid":       puid,
+	})
+	req, _ := NewUpstreamRequest(ctx, ProviderArkose, http.MethodPost, p.Url, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set(AuthorizationHeader, "Bearer "+p.Token)
+	}
+	resp, err := GetClient(ProviderArkose).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(arkoseSolverErrorMessage, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var solverResponse struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &solverResponse); err != nil {
+		return strings.TrimSpace(string(body)), nil
+	}
+	return solverResponse.Token, nil
+}
+
+type pooledToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// TokenPool hands out pre-solved tokens, oldest first, skipping the ones that expired.
+type TokenPool struct {
+	mu     sync.Mutex
+	tokens []pooledToken
+}
+
+func NewTokenPool() *TokenPool {
+	return &TokenPool{}
+}
+
+func (p *TokenPool) Name() string {
+	return arkoseProviderPool
+}
+
+func (p *TokenPool) Add(token string, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.tokens = append(p.tokens, pooledToken{token: token, expiresAt: time.Now().Add(ttl)})
+}
+
+func (p *TokenPool) GetToken(context.Context, string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.tokens) != 0 {
+		token := p.tokens[0]
+		p.tokens = p.tokens[1:]
+		if time.Now().Before(token.expiresAt) {
+			return token.token, nil
+		}
+	}
+	return "", errors.New(emptyArkoseTokenPoolErrorMessage)
+}
+
+// Size counts the tokens that have not expired yet.
+func (p *TokenPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	size := 0
+	for _, token := range p.tokens {
+		if now.Before(token.expiresAt) {
+			size++
+		}
+	}
+	return size
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/xqdoo00o/funcaptcha"
+)
+
+// HarProvider replays the arkose request recorded in a browser HAR export, re-encrypting its
+// fingerprint for the current time window so that the recording keeps working.
+type HarProvider struct {
+	Path string
+
+	once    sync.Once
+	request *harArkoseRequest
+	err     error
+}
+
+type harArkoseRequest struct {
+	url       string
+	header    http.Header
+	form      url.Values
+	bx        string
+	userAgent string
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime string `json:"startedDateTime"`
+			Request         struct {
+				Method   string         `json:"method"`
+				URL      string         `json:"url"`
+				Headers  []harNameValue `json:"headers"`
+				PostData struct {
+					Params []harNameValue `json:"params"`
+					Text   string         `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (p *HarProvider) Name() string {
+	return arkoseProviderHar
+}
+
+func (p *HarProvider) GetToken(ctx context.Context, puid string) (string, error) {
+	p.once.Do(func() {
+		p.request, p.err = readHarArkoseRequest(p.Path)
+	})
+	if p.err != nil {
+		return "", p.err
+	}
+
+	form := url.Values{}
+	for name, values := range p.request.form {
+		form[name] = append([]string(nil), values...)
+	}
+	if p.request.bx != "" {
+		bda := funcaptcha.Encrypt(p.request.bx, p.request.userAgent+arkoseBw(time.Now().Unix()))
+		form.Set("bda", base64.StdEncoding.EncodeToString([]byte(bda)))
+	}
+	form.Set("rnd", strconv.FormatFloat(rand.Float64(), 'f', -1, 64))
+
+	req, _ := NewUpstreamRequest(ctx, ProviderArkose, http.MethodPost, p.request.url, strings.NewReader(form.Encode()))
+	req.Header = p.request.header.Clone()
+	if puid != "" {
+		req.Header.Set("Cookie", "_puid="+puid+";")
+	}
+	resp, err := GetClient(ProviderArkose).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(arkoseHarReplayErrorMessage, resp.Status)
+	}
+
+	var arkoseResponse struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&arkoseResponse); err != nil {
+		return "", err
+	}
+	return arkoseResponse.Token, nil
+}
+
+func readHarArkoseRequest(path string) (*harArkoseRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf(invalidHarFileErrorMessage, path, err.Error())
+	}
+
+	for _, entry := range har.Log.Entries {
+		if !strings.HasPrefix(entry.Request.URL, arkoseUrlPrefix) || !strings.Contains(entry.Request.URL, arkoseChatPublicKey) {
+			continue
+		}
+
+		request := &harArkoseRequest{
+			url:    entry.Request.URL,
+			header: http.Header{},
+			form:   url.Values{},
+		}
+		for _, header := range entry.Request.Headers {
+			// pseudo headers, cookies and the length are not replayable
+			if strings.HasPrefix(header.Name, ":") || strings.EqualFold(header.Name, "cookie") || strings.EqualFold(header.Name, "content-length") {
+				continue
+			}
+			request.header.Set(header.Name, header.Value)
+		}
+		request.userAgent = request.header.Get("User-Agent")
+
+		params := entry.Request.PostData.Params
+		if len(params) == 0 {
+			form, _ := url.ParseQuery(entry.Request.PostData.Text)
+			for name := range form {
+				params = append(params, harNameValue{Name: name, Value: url.QueryEscape(form.Get(name))})
+			}
+		}
+		for _, param := range params {
+			value, err := url.QueryUnescape(param.Value)
+			if err != nil {
+				value = param.Value
+			}
+			request.form.Set(param.Name, value)
+		}
+
+		// without the fingerprint the recorded bda is replayed as is and only lasts for its time window
+		if bda := request.form.Get("bda"); bda != "" {
+			startedAt, _ := time.Parse(time.RFC3339, entry.StartedDateTime)
+			request.bx = funcaptcha.Decrypt(bda, request.userAgent+arkoseBw(startedAt.Unix()), request.userAgent+arkoseBw(startedAt.Unix()-arkoseBwWindow))
+		}
+
+		return request, nil
+	}
+
+	return nil, fmt.Errorf(noArkoseRequestInHarErrorMessage, path)
+}
+
+func arkoseBw(t int64) string {
+	return strconv.FormatInt(t-t%arkoseBwWindow, 10)
+}
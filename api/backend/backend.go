@@ -0,0 +1,334 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+type Backend struct {
+	Name            string
+	ChatCompletions gin.HandlerFunc
+	Embeddings      gin.HandlerFunc
+}
+
+type UpstreamError struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Status is the HTTP status front-ends should report, backends sometimes fail with 200.
+func (e *UpstreamError) Status() int {
+	statusCode, _ := api.ParseUpstreamError(e.StatusCode, e.Body)
+	return statusCode
+}
+
+// Message extracts a readable message from the different error shapes the backends produce.
+func (e *UpstreamError) Message() string {
+	_, err := api.ParseUpstreamError(e.StatusCode, e.Body)
+	return err.Message
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("backend returned status %d: %s", e.StatusCode, e.Message())
+}
+
+var (
+	backends = map[string]Backend{}
+	mu       sync.RWMutex
+)
+
+// Register makes a chat completions handler available to the protocol front-ends (gemini, ollama, responses ...).
+func Register(name string, chatCompletions gin.HandlerFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	backend := backends[name]
+	backend.Name = name
+	backend.ChatCompletions = chatCompletions
+	backends[name] = backend
+}
+
+// RegisterEmbeddings adds an embeddings handler to a backend.
+func RegisterEmbeddings(name string, embeddings gin.HandlerFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	backend := backends[name]
+	backend.Name = name
+	backend.Embeddings = embeddings
+	backends[name] = backend
+}
+
+// Resolve picks the backend for a model, using the longest matching prefix of BACKEND_ROUTES
+// (e.g. "claude-=patgpt,gpt-=imitate") and falling back to DEFAULT_BACKEND.
+func Resolve(model string) (Backend, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	name := os.Getenv("DEFAULT_BACKEND")
+	if name == "" {
+		name = defaultBackend
+	}
+
+	matched := ""
+	for _, route := range strings.Split(os.Getenv("BACKEND_ROUTES"), ",") {
+		prefix, target, found := strings.Cut(strings.TrimSpace(route), "=")
+		if !found || !strings.HasPrefix(model, prefix) || len(prefix) < len(matched) {
+			continue
+		}
+		matched = prefix
+		name = strings.TrimSpace(target)
+	}
+
+	backend, ok := backends[name]
+	if !ok || backend.ChatCompletions == nil {
+		return Backend{}, fmt.Errorf(unknownBackendErrorMessage, name)
+	}
+	return backend, nil
+}
+
+// Complete runs a non-streaming chat completion through the backend serving request.Model.
+func Complete(c *gin.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	backend, err := Resolve(request.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	return complete(c, chatCompletionsPath(backend.Name), backend.ChatCompletions, request)
+}
+
+// Stream runs a streaming chat completion, calling onChunk for every chunk the backend emits.
+// c.Writer is swapped while the backend runs, so onChunk must write to a writer captured beforehand.
+// Nothing has been written to the client when an error is returned before the first chunk.
+func Stream(c *gin.Context, request ChatCompletionRequest, onChunk func(ChatCompletion)) error {
+	backend, err := Resolve(request.Model)
+	if err != nil {
+		return err
+	}
+
+	return stream(c, chatCompletionsPath(backend.Name), backend.ChatCompletions, request, onChunk)
+}
+
+func complete(c *gin.Context, path string, handler gin.HandlerFunc, request ChatCompletionRequest) (*ChatCompletion, error) {
+	request.Stream = false
+	request.StreamOptions = nil
+	body, _ := json.Marshal(request)
+	recorder, err := serve(c, path, handler, body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := recorder.body.Bytes()
+	var completion ChatCompletion
+	if err := json.Unmarshal(data, &completion); err == nil && len(completion.Choices) != 0 {
+		return &completion, nil
+	}
+
+	// some backends answer with SSE even if streaming was not requested
+	var chunks []ChatCompletion
+	for _, line := range strings.Split(string(data), "\n") {
+		if chunk, ok := parseEvent(line); ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, &UpstreamError{StatusCode: recorder.status, Body: data}
+	}
+	return Merge(chunks), nil
+}
+
+func stream(c *gin.Context, path string, handler gin.HandlerFunc, request ChatCompletionRequest, onChunk func(ChatCompletion)) error {
+	request.Stream = true
+	body, _ := json.Marshal(request)
+	recorder, err := serve(c, path, handler, body, onChunk)
+	if err != nil {
+		return err
+	}
+	if recorder.streamError != nil {
+		return &UpstreamError{StatusCode: recorder.streamErrorStatus(), Body: recorder.streamError}
+	}
+
+	if recorder.chunks == 0 {
+		// the backend ignored stream and answered with a single completion
+		var completion ChatCompletion
+		if err := json.Unmarshal(recorder.body.Bytes(), &completion); err != nil || len(completion.Choices) == 0 {
+			return &UpstreamError{StatusCode: recorder.status, Body: recorder.body.Bytes()}
+		}
+		for i, choice := range completion.Choices {
+			completion.Choices[i].Delta = choice.Message
+			completion.Choices[i].Message = nil
+		}
+		onChunk(completion)
+	}
+	return nil
+}
+
+func chatCompletionsPath(name string) string {
+	return "/" + name + "/v1/chat/completions"
+}
+
+// Embed creates embeddings through the backend serving request.Model.
+func Embed(c *gin.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	backend, err := Resolve(request.Model)
+	if err != nil {
+		return nil, err
+	}
+	if backend.Embeddings == nil {
+		return nil, fmt.Errorf(noEmbeddingsErrorMessage, backend.Name)
+	}
+
+	body, _ := json.Marshal(request)
+	rec, err := serve(c, "/"+backend.Name+"/v1/embeddings", backend.Embeddings, body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response EmbeddingResponse
+	if err := json.Unmarshal(rec.body.Bytes(), &response); err == nil && len(response.Data) != 0 {
+		return &response, nil
+	}
+
+	// patsnap wraps the openai response in data
+	var wrapped struct {
+		Data EmbeddingResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), &wrapped); err == nil && len(wrapped.Data.Data) != 0 {
+		return &wrapped.Data, nil
+	}
+	return nil, &UpstreamError{StatusCode: rec.status, Body: rec.body.Bytes()}
+}
+
+// serve runs handler as if the client had posted body to path, capturing the response.
+func serve(c *gin.Context, path string, handler gin.HandlerFunc, body []byte, onChunk func(ChatCompletion)) (*recorder, error) {
+	originalRequest := c.Request
+	originalWriter := c.Writer
+	defer func() {
+		c.Request = originalRequest
+		c.Writer = originalWriter
+	}()
+
+	req := originalRequest.Clone(originalRequest.Context())
+	req.Method = http.MethodPost
+	req.URL.Path = path
+	req.URL.RawQuery = ""
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := newRecorder(originalWriter, onChunk)
+	c.Request = req
+	c.Writer = rec
+	handler(c)
+	rec.finish()
+
+	if rec.status >= 400 {
+		return nil, &UpstreamError{StatusCode: rec.status, Body: rec.body.Bytes()}
+	}
+	return rec, nil
+}
+
+// Merge folds streamed chunks into a single chat completion.
+func Merge(chunks []ChatCompletion) *ChatCompletion {
+	completion := &ChatCompletion{Object: "chat.completion"}
+	choices := map[int]*Choice{}
+	var order []int
+	for _, chunk := range chunks {
+		if completion.ID == "" {
+			completion.ID = chunk.ID
+			completion.Created = chunk.Created
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.Usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			merged, ok := choices[choice.Index]
+			if !ok {
+				merged = &Choice{Index: choice.Index, Message: &ChatMessage{Role: "assistant", Content: ""}}
+				choices[choice.Index] = merged
+				order = append(order, choice.Index)
+			}
+			if choice.FinishReason != "" {
+				merged.FinishReason = choice.FinishReason
+			}
+			if choice.Logprobs != nil {
+				merged.Logprobs = appendLogprobs(merged.Logprobs, choice.Logprobs)
+			}
+			delta := choice.Delta
+			if delta == nil {
+				delta = choice.Message
+			}
+			if delta == nil {
+				continue
+			}
+			merged.Message.Content = merged.Message.Text() + delta.Text()
+			merged.Message.ToolCalls = MergeToolCalls(merged.Message.ToolCalls, delta.ToolCalls)
+		}
+	}
+
+	for _, index := range order {
+		choice := choices[index]
+		if choice.FinishReason == "" {
+			choice.FinishReason = "stop"
+		}
+		completion.Choices = append(completion.Choices, *choice)
+	}
+	return completion
+}
+
+func appendLogprobs(logprobs *Logprobs, delta *Logprobs) *Logprobs {
+	if logprobs == nil {
+		logprobs = &Logprobs{}
+	}
+	logprobs.Content = append(logprobs.Content, delta.Content...)
+	return logprobs
+}
+
+// MergeToolCalls appends streamed tool call fragments, which are keyed by index, to toolCalls.
+func MergeToolCalls(toolCalls []ToolCall, deltas []ToolCall) []ToolCall {
+	for i, delta := range deltas {
+		index := i
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		for len(toolCalls) <= index {
+			toolCalls = append(toolCalls, ToolCall{Type: "function"})
+		}
+		if delta.ID != "" {
+			toolCalls[index].ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			toolCalls[index].Function.Name = delta.Function.Name
+		}
+		toolCalls[index].Function.Arguments += delta.Function.Arguments
+	}
+	return toolCalls
+}
+
+func parseEvent(line string) (ChatCompletion, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "data:") {
+		return ChatCompletion{}, false
+	}
+
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return ChatCompletion{}, false
+	}
+
+	var chunk ChatCompletion
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return ChatCompletion{}, false
+	}
+	return chunk, true
+}
@@ -0,0 +1,318 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// CreateCompletions serves the legacy /v1/completions api on top of a chat completions handler,
+// for upstreams which do not offer native text completions.
+func CreateCompletions(c *gin.Context, chatCompletions gin.HandlerFunc) {
+	var request CompletionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	prompts, err := request.prompts()
+	if err != nil {
+		api.AbortWithParamError(c, http.StatusBadRequest, err.Error(), "prompt")
+		return
+	}
+
+	n := request.N
+	if n <= 0 {
+		n = 1
+	}
+	if request.BestOf != 0 && request.BestOf < n {
+		api.AbortWithParamError(c, http.StatusBadRequest, bestOfErrorMessage, "best_of")
+		return
+	}
+	if request.Stream && request.BestOf > 1 {
+		api.AbortWithParamError(c, http.StatusBadRequest, bestOfStreamErrorMessage, "best_of")
+		return
+	}
+	if request.Logprobs != nil && (*request.Logprobs < 0 || *request.Logprobs > 5) {
+		api.AbortWithParamError(c, http.StatusBadRequest, logprobsErrorMessage, "logprobs")
+		return
+	}
+
+	path := strings.Replace(c.Request.URL.Path, "/completions", "/chat/completions", 1)
+	id := "cmpl-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if request.Stream {
+		streamCompletions(c, path, chatCompletions, request, prompts, n, id)
+		return
+	}
+
+	completion := TextCompletion{
+		ID:      id,
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+		Choices: []TextCompletionChoice{},
+		Usage:   &Usage{},
+	}
+	for i, prompt := range prompts {
+		chatCompletion, err := complete(c, path, chatCompletions, request.chatRequest(prompt))
+		if err != nil {
+			AbortWithError(c, err)
+			return
+		}
+
+		if chatCompletion.Model != "" {
+			completion.Model = chatCompletion.Model
+		}
+		completion.SystemFingerprint = chatCompletion.SystemFingerprint
+		if chatCompletion.Usage != nil {
+			completion.Usage.PromptTokens += chatCompletion.Usage.PromptTokens
+			completion.Usage.CompletionTokens += chatCompletion.Usage.CompletionTokens
+			completion.Usage.TotalTokens += chatCompletion.Usage.TotalTokens
+		}
+
+		// best_of candidates cannot be ranked without scores, the first n are returned
+		for j, choice := range chatCompletion.Choices {
+			if j >= n {
+				break
+			}
+			text := ""
+			if choice.Message != nil {
+				text = choice.Message.Text()
+			}
+			var logprobs *TextCompletionLogprobs
+			if request.Logprobs != nil {
+				logprobs = convertLogprobs(choice.Logprobs, 0)
+			}
+			if request.Echo {
+				text = prompt + text
+				if logprobs != nil {
+					logprobs = prependPrompt(logprobs, prompt)
+				}
+			}
+			completion.Choices = append(completion.Choices, TextCompletionChoice{
+				Text:         text,
+				Index:        i*n + j,
+				Logprobs:     logprobs,
+				FinishReason: choice.FinishReason,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, completion)
+}
+
+func streamCompletions(c *gin.Context, path string, chatCompletions gin.HandlerFunc, request CompletionRequest, prompts []string, n int, id string) {
+	// stream swaps c.Writer while the backend runs, keep the client writer
+	w := c.Writer
+	started := false
+	write := func(chunk TextCompletion) {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Write([]byte("data: " + marshal(chunk) + "\n\n"))
+		w.Flush()
+	}
+	newChunk := func(model string) TextCompletion {
+		return TextCompletion{ID: id, Object: "text_completion", Created: time.Now().Unix(), Model: model}
+	}
+
+	usage := &Usage{}
+	for i, prompt := range prompts {
+		if request.Echo {
+			for j := 0; j < n; j++ {
+				chunk := newChunk(request.Model)
+				chunk.Choices = []TextCompletionChoice{{Text: prompt, Index: i*n + j}}
+				write(chunk)
+			}
+		}
+
+		offsets := map[int]int{}
+		chatRequest := request.chatRequest(prompt)
+		chatRequest.StreamOptions = &StreamOptions{IncludeUsage: true}
+		err := stream(c, path, chatCompletions, chatRequest, func(chatChunk ChatCompletion) {
+			if chatChunk.Usage != nil {
+				usage.PromptTokens += chatChunk.Usage.PromptTokens
+				usage.CompletionTokens += chatChunk.Usage.CompletionTokens
+				usage.TotalTokens += chatChunk.Usage.TotalTokens
+			}
+
+			chunk := newChunk(chatChunk.Model)
+			if chunk.Model == "" {
+				chunk.Model = request.Model
+			}
+			for _, choice := range chatChunk.Choices {
+				if choice.Index >= n {
+					continue
+				}
+				text := ""
+				if choice.Delta != nil {
+					text = choice.Delta.Text()
+				}
+				if text == "" && choice.FinishReason == "" {
+					continue
+				}
+				offset, ok := offsets[choice.Index]
+				if !ok && request.Echo {
+					// the echoed prompt went out first, as prependPrompt does for the non-stream answer
+					offset = len(prompt)
+				}
+				var logprobs *TextCompletionLogprobs
+				if request.Logprobs != nil {
+					logprobs = convertLogprobs(choice.Logprobs, offset)
+				}
+				offsets[choice.Index] = offset + len(text)
+				var finishReason any
+				if choice.FinishReason != "" {
+					finishReason = choice.FinishReason
+				}
+				chunk.Choices = append(chunk.Choices, TextCompletionChoice{
+					Text:         text,
+					Index:        i*n + choice.Index,
+					Logprobs:     logprobs,
+					FinishReason: finishReason,
+				})
+			}
+			if len(chunk.Choices) != 0 {
+				write(chunk)
+			}
+		})
+		if err != nil {
+			if !started {
+				AbortWithError(c, err)
+				return
+			}
+			// the stream has started, the error is its final event
+			_, e := ToError(err)
+			logger.Warn(e.Message)
+			api.WriteStreamError(w, e)
+			return
+		}
+	}
+
+	if request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		chunk := newChunk(request.Model)
+		chunk.Choices = []TextCompletionChoice{}
+		chunk.Usage = usage
+		write(chunk)
+	}
+	if started {
+		w.Write([]byte("data: [DONE]\n\n"))
+		w.Flush()
+	}
+}
+
+func (request CompletionRequest) prompts() ([]string, error) {
+	switch prompt := request.Prompt.(type) {
+	case nil:
+		// the api defaults to <|endoftext|>, which means "start of a new document"
+		return []string{""}, nil
+	case string:
+		return []string{prompt}, nil
+	case []interface{}:
+		var prompts []string
+		for _, item := range prompt {
+			text, ok := item.(string)
+			if !ok {
+				return nil, errors.New(tokenPromptErrorMessage)
+			}
+			prompts = append(prompts, text)
+		}
+		if len(prompts) == 0 {
+			return nil, errors.New(emptyPromptErrorMessage)
+		}
+		return prompts, nil
+	}
+	return nil, errors.New(tokenPromptErrorMessage)
+}
+
+func (request CompletionRequest) chatRequest(prompt string) ChatCompletionRequest {
+	instruction := completionInstruction
+	if request.Suffix != "" {
+		instruction += fmt.Sprintf(completionSuffixInstruction, request.Suffix)
+	}
+
+	n := request.N
+	if request.BestOf > n {
+		n = request.BestOf
+	}
+
+	chatRequest := ChatCompletionRequest{
+		Model: request.Model,
+		Messages: []ChatMessage{
+			{Role: "system", Content: instruction},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:        request.MaxTokens,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		N:                n,
+		PresencePenalty:  request.PresencePenalty,
+		FrequencyPenalty: request.FrequencyPenalty,
+		LogitBias:        request.LogitBias,
+		Seed:             request.Seed,
+		User:             request.User,
+	}
+	if n == 1 {
+		chatRequest.N = 0
+	}
+
+	switch stop := request.Stop.(type) {
+	case string:
+		chatRequest.Stop = []string{stop}
+	case []interface{}:
+		for _, item := range stop {
+			if s, ok := item.(string); ok {
+				chatRequest.Stop = append(chatRequest.Stop, s)
+			}
+		}
+	}
+
+	if request.Logprobs != nil {
+		chatRequest.Logprobs = true
+		chatRequest.TopLogprobs = *request.Logprobs
+	}
+	return chatRequest
+}
+
+func convertLogprobs(logprobs *Logprobs, offset int) *TextCompletionLogprobs {
+	converted := &TextCompletionLogprobs{
+		Tokens:        []string{},
+		TokenLogprobs: []float64{},
+		TopLogprobs:   []map[string]float64{},
+		TextOffset:    []int{},
+	}
+	if logprobs == nil {
+		return converted
+	}
+
+	for _, token := range logprobs.Content {
+		converted.Tokens = append(converted.Tokens, token.Token)
+		converted.TokenLogprobs = append(converted.TokenLogprobs, token.Logprob)
+		top := map[string]float64{}
+		for _, candidate := range token.TopLogprobs {
+			top[candidate.Token] = candidate.Logprob
+		}
+		converted.TopLogprobs = append(converted.TopLogprobs, top)
+		converted.TextOffset = append(converted.TextOffset, offset)
+		offset += len(token.Token)
+	}
+	return converted
+}
+
+// prependPrompt shifts the offsets of echoed completions, prompt tokens have no scores.
+func prependPrompt(logprobs *TextCompletionLogprobs, prompt string) *TextCompletionLogprobs {
+	for i := range logprobs.TextOffset {
+		logprobs.TextOffset[i] += len(prompt)
+	}
+	return logprobs
+}
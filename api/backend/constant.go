@@ -0,0 +1,17 @@
+package backend
+
+const (
+	defaultBackend             = "patgpt_new"
+	unknownBackendErrorMessage = "backend %s is not registered"
+	noEmbeddingsErrorMessage   = "backend %s does not support embeddings"
+
+	parseJsonErrorMessage    = "failed to parse json request body"
+	tokenPromptErrorMessage  = "prompt must be a string or an array of strings, token arrays are not supported"
+	emptyPromptErrorMessage  = "prompt must not be empty"
+	bestOfErrorMessage       = "best_of must be greater than or equal to n"
+	bestOfStreamErrorMessage = "best_of cannot be used with stream"
+	logprobsErrorMessage     = "logprobs must be between 0 and 5"
+
+	completionInstruction       = "You are a text completion engine. Continue the text given by the user exactly where it stops. Output only the continuation, never repeat the text and never add comments."
+	completionSuffixInstruction = " The continuation is followed by this text, output only what belongs in between: %s"
+)
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+// ToError converts a dispatch error into the status and OpenAI error front-ends report.
+func ToError(err error) (int, *api.Error) {
+	var upstreamError *UpstreamError
+	if errors.As(err, &upstreamError) {
+		return api.ParseUpstreamError(upstreamError.StatusCode, upstreamError.Body)
+	}
+
+	return http.StatusInternalServerError, api.NewError(http.StatusInternalServerError, err.Error())
+}
+
+// AbortWithError reports a dispatch error, as a terminal SSE event once the stream has started.
+func AbortWithError(c *gin.Context, err error) {
+	statusCode, e := ToError(err)
+	api.Abort(c, statusCode, e)
+}
+
+func marshal(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
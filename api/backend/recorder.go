@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+var errNotSupported = errors.New("not supported by backend recorder")
+
+// recorder captures what a backend handler writes so that front-ends can translate it.
+// Successful SSE output is parsed line by line and handed to onChunk as it arrives.
+type recorder struct {
+	gin.ResponseWriter
+
+	header  http.Header
+	status  int
+	size    int
+	body    bytes.Buffer
+	pending string
+	chunks  int
+	onChunk func(ChatCompletion)
+
+	// streamError is the error event a backend emitted after its stream started
+	streamError []byte
+}
+
+func newRecorder(w gin.ResponseWriter, onChunk func(ChatCompletion)) *recorder {
+	return &recorder{
+		ResponseWriter: w,
+		header:         http.Header{},
+		status:         http.StatusOK,
+		size:           -1,
+		onChunk:        onChunk,
+	}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if code > 0 && !r.Written() {
+		r.status = code
+	}
+}
+
+func (r *recorder) WriteHeaderNow() {
+	if !r.Written() {
+		r.size = 0
+	}
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	r.WriteHeaderNow()
+	r.size += len(data)
+
+	if r.onChunk == nil || r.status >= 400 {
+		return r.body.Write(data)
+	}
+
+	r.pending += string(data)
+	for {
+		index := strings.IndexByte(r.pending, '\n')
+		if index < 0 {
+			break
+		}
+		line := r.pending[:index]
+		r.pending = r.pending[index+1:]
+		r.line(line)
+	}
+	return len(data), nil
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+func (r *recorder) line(line string) {
+	if r.streamError != nil {
+		return
+	}
+	if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+		if _, ok := api.ParseStreamError([]byte(data)); ok {
+			r.streamError = []byte(data)
+			return
+		}
+	}
+	if chunk, ok := parseEvent(line); ok {
+		r.chunks++
+		r.onChunk(chunk)
+		return
+	}
+	if !strings.HasPrefix(strings.TrimSpace(line), "data:") {
+		// keep non SSE output, it may be a plain JSON completion or error
+		r.body.WriteString(line + "\n")
+	}
+}
+
+func (r *recorder) finish() {
+	if r.pending != "" {
+		line := r.pending
+		r.pending = ""
+		r.line(line)
+	}
+}
+
+func (r *recorder) streamErrorStatus() int {
+	e, _ := api.ParseStreamError(r.streamError)
+	return api.ErrorStatus(e.Type)
+}
+
+func (r *recorder) Status() int {
+	return r.status
+}
+
+func (r *recorder) Size() int {
+	return r.size
+}
+
+func (r *recorder) Written() bool {
+	return r.size != -1
+}
+
+func (r *recorder) Flush() {}
+
+func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errNotSupported
+}
+
+func (r *recorder) Pusher() http.Pusher {
+	return nil
+}
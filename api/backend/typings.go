@@ -0,0 +1,220 @@
+package backend
+
+import "encoding/json"
+
+type ChatCompletionRequest struct {
+	Model            string         `json:"model"`
+	Messages         []ChatMessage  `json:"messages"`
+	Stream           bool           `json:"stream"`
+	StreamOptions    *StreamOptions `json:"stream_options,omitempty"`
+	Temperature      *float64       `json:"temperature,omitempty"`
+	TopP             *float64       `json:"top_p,omitempty"`
+	MaxTokens        int            `json:"max_tokens,omitempty"`
+	Stop             []string       `json:"stop,omitempty"`
+	N                int            `json:"n,omitempty"`
+	PresencePenalty  *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64       `json:"frequency_penalty,omitempty"`
+	Seed             *int           `json:"seed,omitempty"`
+	Logprobs         bool           `json:"logprobs,omitempty"`
+	TopLogprobs      int            `json:"top_logprobs,omitempty"`
+	LogitBias        any            `json:"logit_bias,omitempty"`
+	Tools            []Tool         `json:"tools,omitempty"`
+	ToolChoice       any            `json:"tool_choice,omitempty"`
+	ResponseFormat   any            `json:"response_format,omitempty"`
+	User             string         `json:"user,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ChatMessage struct {
+	Role       string     `json:"role,omitempty"`
+	Content    any        `json:"content"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Text returns the plain text of a message whose content is either a string or an array of parts.
+func (m ChatMessage) Text() string {
+	switch content := m.Content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		text := ""
+		for _, part := range content {
+			if p, ok := part.(map[string]interface{}); ok && p["type"] == "text" {
+				if s, ok := p["text"].(string); ok {
+					text += s
+				}
+			}
+		}
+		return text
+	case []ContentPart:
+		text := ""
+		for _, part := range content {
+			if part.Type == "text" {
+				text += part.Text
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type ChatCompletion struct {
+	ID                string   `json:"id"`
+	Object            string   `json:"object"`
+	Created           int64    `json:"created"`
+	Model             string   `json:"model"`
+	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+	Choices           []Choice `json:"choices"`
+	Usage             *Usage   `json:"usage,omitempty"`
+}
+
+type Choice struct {
+	Index        int          `json:"index"`
+	Message      *ChatMessage `json:"message,omitempty"`
+	Delta        *ChatMessage `json:"delta,omitempty"`
+	Logprobs     *Logprobs    `json:"logprobs,omitempty"`
+	FinishReason string       `json:"finish_reason"`
+}
+
+type Logprobs struct {
+	Content []TokenLogprob `json:"content"`
+}
+
+type TokenLogprob struct {
+	Token       string         `json:"token"`
+	Logprob     float64        `json:"logprob"`
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// UnmarshalJSON tolerates upstreams that report finish_reason as a number or null.
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	type alias Choice
+	var raw struct {
+		alias
+		FinishReason any `json:"finish_reason"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*c = Choice(raw.alias)
+	switch reason := raw.FinishReason.(type) {
+	case string:
+		c.FinishReason = reason
+	case nil:
+		c.FinishReason = ""
+	default:
+		c.FinishReason = "stop"
+	}
+	return nil
+}
+
+type EmbeddingRequest struct {
+	Input          any    `json:"input"`
+	Model          string `json:"model"`
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	Dimensions     int    `json:"dimensions,omitempty"`
+}
+
+type EmbeddingResponse struct {
+	Object string      `json:"object"`
+	Model  string      `json:"model"`
+	Data   []Embedding `json:"data"`
+	Usage  *Usage      `json:"usage,omitempty"`
+}
+
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+type CompletionRequest struct {
+	Model            string         `json:"model"`
+	Prompt           any            `json:"prompt"`
+	Suffix           string         `json:"suffix,omitempty"`
+	Echo             bool           `json:"echo,omitempty"`
+	BestOf           int            `json:"best_of,omitempty"`
+	Logprobs         *int           `json:"logprobs,omitempty"`
+	MaxTokens        int            `json:"max_tokens,omitempty"`
+	Temperature      *float64       `json:"temperature,omitempty"`
+	TopP             *float64       `json:"top_p,omitempty"`
+	N                int            `json:"n,omitempty"`
+	Stream           bool           `json:"stream"`
+	StreamOptions    *StreamOptions `json:"stream_options,omitempty"`
+	Stop             any            `json:"stop,omitempty"`
+	PresencePenalty  *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64       `json:"frequency_penalty,omitempty"`
+	LogitBias        any            `json:"logit_bias,omitempty"`
+	Seed             *int           `json:"seed,omitempty"`
+	User             string         `json:"user,omitempty"`
+}
+
+type TextCompletion struct {
+	ID                string                 `json:"id"`
+	Object            string                 `json:"object"`
+	Created           int64                  `json:"created"`
+	Model             string                 `json:"model"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	Choices           []TextCompletionChoice `json:"choices"`
+	Usage             *Usage                 `json:"usage,omitempty"`
+}
+
+type TextCompletionChoice struct {
+	Text         string                  `json:"text"`
+	Index        int                     `json:"index"`
+	Logprobs     *TextCompletionLogprobs `json:"logprobs"`
+	FinishReason any                     `json:"finish_reason"`
+}
+
+type TextCompletionLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
+	TextOffset    []int                `json:"text_offset"`
+}
@@ -18,7 +18,7 @@ import (
 func CreateConversation(c *gin.Context) {
 	var request CreateConversationRequest
 	if err := c.BindJSON(&request); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(parseJsonErrorMessage))
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
 		return
 	}
 
@@ -40,35 +40,35 @@ func CreateConversation(c *gin.Context) {
 	}
 
 	if strings.HasPrefix(request.Model, gpt4Model) && request.ArkoseToken == "" {
-		arkoseToken, err := api.GetArkoseToken()
+		arkoseToken, err := api.GetArkoseToken(c.Request.Context())
 		if err != nil || arkoseToken == "" {
-			c.AbortWithStatusJSON(http.StatusForbidden, api.ReturnMessage(err.Error()))
+			api.AbortWithError(c, http.StatusForbidden, err.Error())
 			return
 		}
 
 		request.ArkoseToken = arkoseToken
 	}
 
-	resp, done := sendConversationRequest(c, request)
-	if done {
-		return
-	}
+	maxContinuations := MaxContinuations(request.MaxContinuations, request.AutoContinue)
+	request.MaxContinuations = nil
 
-	handleConversationResponse(c, resp, request)
+	Continue(c, request, maxContinuations, sendConversationRequest, func(resp *http.Response, canContinue bool) (*ContinueInfo, bool) {
+		return handleConversationResponse(c, resp, canContinue)
+	})
 }
 
 func sendConversationRequest(c *gin.Context, request CreateConversationRequest) (*http.Response, bool) {
 	jsonBytes, _ := json.Marshal(request)
-	req, _ := http.NewRequest(http.MethodPost, api.ChatGPTApiUrlPrefix+"/backend-api/conversation", bytes.NewBuffer(jsonBytes))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, http.MethodPost, api.ChatGPTApiUrlPrefix+"/backend-api/conversation", bytes.NewBuffer(jsonBytes))
 	req.Header.Set("User-Agent", api.UserAgent)
 	req.Header.Set(api.AuthorizationHeader, api.GetAccessToken(c))
 	req.Header.Set("Accept", "text/event-stream")
-	if api.PUID != "" {
-		req.Header.Set("Cookie", "_puid="+api.PUID)
+	if puid := api.GetPUID(); puid != "" {
+		req.Header.Set("Cookie", "_puid="+puid)
 	}
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderChatGPT).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return nil, true
 	}
 
@@ -77,18 +77,16 @@ func sendConversationRequest(c *gin.Context, request CreateConversationRequest)
 
 		if resp.StatusCode == http.StatusUnauthorized {
 			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
-			responseMap := make(map[string]interface{})
-			json.NewDecoder(resp.Body).Decode(&responseMap)
-			c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+			api.AbortWithUpstreamResponse(c, resp)
 			return nil, true
 		}
 
-		req, _ := http.NewRequest(http.MethodGet, api.ChatGPTApiUrlPrefix+"/backend-api/models?history_and_training_disabled=false", nil)
+		req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, http.MethodGet, api.ChatGPTApiUrlPrefix+"/backend-api/models?history_and_training_disabled=false", nil)
 		req.Header.Set("User-Agent", api.UserAgent)
 		req.Header.Set(api.AuthorizationHeader, api.GetAccessToken(c))
-		response, err := api.Client.Do(req)
+		response, err := api.GetClient(api.ProviderChatGPT).Do(req)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+			api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 			return nil, true
 		}
 
@@ -103,30 +101,23 @@ func sendConversationRequest(c *gin.Context, request CreateConversationRequest)
 			}
 		}
 		if !modelAvailable {
-			c.AbortWithStatusJSON(http.StatusForbidden, api.ReturnMessage(noModelPermissionErrorMessage))
+			api.AbortWithError(c, http.StatusForbidden, noModelPermissionErrorMessage)
 			return nil, true
 		}
 
 		data, _ := io.ReadAll(resp.Body)
-		logger.Warn(string(data))
-
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamError(c, resp.StatusCode, data)
 		return nil, true
 	}
 
 	return resp, false
 }
 
-func handleConversationResponse(c *gin.Context, resp *http.Response, request CreateConversationRequest) {
+func handleConversationResponse(c *gin.Context, resp *http.Response, canContinue bool) (*ContinueInfo, bool) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 
-	isMaxTokens := false
-	continueParentMessageID := ""
-	continueConversationID := ""
+	var continueInfo *ContinueInfo
 
-	defer resp.Body.Close()
 	reader := bufio.NewReader(resp.Body)
 	for {
 		if c.Request.Context().Err() != nil {
@@ -135,6 +126,10 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 
 		line, err := reader.ReadString('\n')
 		if err != nil {
+			if err != io.EOF {
+				api.AbortWithError(c, http.StatusBadGateway, err.Error())
+				return nil, false
+			}
 			break
 		}
 
@@ -147,7 +142,7 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 		}
 
 		responseJson := line[6:]
-		if strings.HasPrefix(responseJson, "[DONE]") && isMaxTokens && request.AutoContinue {
+		if strings.HasPrefix(responseJson, "[DONE]") && continueInfo != nil && canContinue {
 			continue
 		}
 
@@ -157,9 +152,10 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 			json.Unmarshal([]byte(responseJson), &createConversationResponse)
 			message := createConversationResponse.Message
 			if message.Metadata.FinishDetails.Type == responseTypeMaxTokens && createConversationResponse.Message.Status == responseStatusFinishedSuccessfully {
-				isMaxTokens = true
-				continueParentMessageID = message.ID
-				continueConversationID = createConversationResponse.ConversationID
+				continueInfo = &ContinueInfo{
+					ConversationID: createConversationResponse.ConversationID,
+					ParentID:       message.ID,
+				}
 			}
 		}
 
@@ -167,22 +163,5 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 		c.Writer.Flush()
 	}
 
-	if isMaxTokens && request.AutoContinue {
-		continueConversationRequest := CreateConversationRequest{
-			ArkoseToken:                request.ArkoseToken,
-			HistoryAndTrainingDisabled: request.HistoryAndTrainingDisabled,
-			Model:                      request.Model,
-			TimezoneOffsetMin:          request.TimezoneOffsetMin,
-
-			Action:          actionContinue,
-			ParentMessageID: continueParentMessageID,
-			ConversationID:  &continueConversationID,
-		}
-		resp, done := sendConversationRequest(c, continueConversationRequest)
-		if done {
-			return
-		}
-
-		handleConversationResponse(c, resp, continueConversationRequest)
-	}
+	return continueInfo, true
 }
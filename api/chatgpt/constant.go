@@ -6,7 +6,34 @@ const (
 
 	gpt4Model                          = "gpt-4"
 	actionContinue                     = "continue"
+	defaultMaxContinuations            = 3
+	maxContinuationsLimit              = 10
 	responseTypeMaxTokens              = "max_tokens"
 	responseStatusFinishedSuccessfully = "finished_successfully"
 	noModelPermissionErrorMessage      = "you have no permission to use this model"
+
+	defaultConversationsLimit         = 28
+	maxConversationsLimit             = 100
+	invalidOffsetErrorMessage         = "offset must be a non-negative integer"
+	invalidLimitErrorMessage          = "limit must be an integer between 1 and 100"
+	invalidOrderErrorMessage          = "order must be 'updated' or 'created'"
+	emptyUpdateErrorMessage           = "title or is_visible is required"
+	emptyTitleErrorMessage            = "title must not be empty"
+	emptyMessageIDErrorMessage        = "message_id is required"
+	parseUpstreamResponseErrorMessage = "failed to parse upstream response"
+
+	exportFormatMarkdown            = "markdown"
+	exportFormatJson                = "json"
+	exportFormatOpenAI              = "openai"
+	invalidExportFormatErrorMessage = "format must be one of 'markdown', 'json', 'openai'"
+
+	fileUseCaseMultimodal     = "multimodal"
+	fileUseCaseMyFiles        = "my_files"
+	fileServicePrefix         = "file-service://"
+	contentTypeMultimodalText = "multimodal_text"
+	contentTypeImageAsset     = "image_asset_pointer"
+	missingFileErrorMessage   = "missing required form field: 'file'"
+	createFileErrorMessage    = "failed to create upload: %s"
+	uploadFileErrorMessage    = "failed to upload file: %s"
+	confirmUploadErrorMessage = "failed to confirm upload: %s"
 )
@@ -0,0 +1,72 @@
+package chatgpt
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// ContinueInfo points at the truncated answer a "continue" request picks up from.
+type ContinueInfo struct {
+	ConversationID string `json:"conversation_id"`
+	ParentID       string `json:"parent_id"`
+}
+
+type SendFunc func(c *gin.Context, request CreateConversationRequest) (*http.Response, bool)
+
+// HandleFunc consumes one upstream response. canContinue tells it whether a truncated answer will be
+// continued, so that it can hold back its end of stream markers. It returns where to continue from when
+// the answer was cut off by max_tokens, and false once the request has been aborted.
+type HandleFunc func(resp *http.Response, canContinue bool) (*ContinueInfo, bool)
+
+// Continue sends the request and keeps issuing "continue" requests while the answer is truncated,
+// at most maxContinuations times. It returns false when the request was aborted along the way.
+func Continue(c *gin.Context, request CreateConversationRequest, maxContinuations int, send SendFunc, handle HandleFunc) bool {
+	for i := 0; ; i++ {
+		resp, done := send(c, request)
+		if done {
+			return false
+		}
+
+		continueInfo, ok := handleResponse(resp, i < maxContinuations, handle)
+		if !ok {
+			return false
+		}
+		if continueInfo == nil || i >= maxContinuations || c.Request.Context().Err() != nil {
+			return true
+		}
+
+		request = request.continueRequest(*continueInfo)
+	}
+}
+
+func handleResponse(resp *http.Response, canContinue bool, handle HandleFunc) (*ContinueInfo, bool) {
+	defer resp.Body.Close()
+	return handle(resp, canContinue)
+}
+
+func (r CreateConversationRequest) continueRequest(continueInfo ContinueInfo) CreateConversationRequest {
+	return CreateConversationRequest{
+		ArkoseToken:                r.ArkoseToken,
+		HistoryAndTrainingDisabled: r.HistoryAndTrainingDisabled,
+		Model:                      r.Model,
+		PluginIDs:                  r.PluginIDs,
+		TimezoneOffsetMin:          r.TimezoneOffsetMin,
+
+		Action:          actionContinue,
+		ParentMessageID: continueInfo.ParentID,
+		ConversationID:  &continueInfo.ConversationID,
+	}
+}
+
+// MaxContinuations resolves the continuation limit of a request: an explicit value wins,
+// otherwise enabled turns on the default.
+func MaxContinuations(requested *int, enabled bool) int {
+	if requested == nil {
+		if enabled {
+			return defaultMaxContinuations
+		}
+		return 0
+	}
+
+	return min(max(*requested, 0), maxContinuationsLimit)
+}
@@ -0,0 +1,207 @@
+package chatgpt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+func GetConversations(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidOffsetErrorMessage, "offset")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultConversationsLimit)))
+	if err != nil || limit < 1 || limit > maxConversationsLimit {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidLimitErrorMessage, "limit")
+		return
+	}
+	order := c.DefaultQuery("order", "updated")
+	if order != "updated" && order != "created" {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidOrderErrorMessage, "order")
+		return
+	}
+
+	// parameters this gateway does not know about are passed on as they are
+	query := c.Request.URL.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("order", order)
+
+	var response json.RawMessage
+	if done := doRequest(c, http.MethodGet, "/conversations?"+query.Encode(), nil, &response); done {
+		return
+	}
+
+	relayJSON(c, response, &GetConversationsResponse{})
+}
+
+// UpdateConversations applies the update to every conversation, {"is_visible": false} deletes them all.
+func UpdateConversations(c *gin.Context) {
+	request, done := bindUpdateConversationRequest(c)
+	if done {
+		return
+	}
+
+	var response UpdateConversationResponse
+	if done := doRequest(c, http.MethodPatch, "/conversations", request, &response); done {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func GetConversation(c *gin.Context) {
+	var response json.RawMessage
+	if done := doRequest(c, http.MethodGet, "/conversation/"+c.Param("id"), nil, &response); done {
+		return
+	}
+
+	relayJSON(c, response, &Conversation{})
+}
+
+// UpdateConversation renames a conversation or hides it, hiding is how chatgpt deletes conversations.
+func UpdateConversation(c *gin.Context) {
+	request, done := bindUpdateConversationRequest(c)
+	if done {
+		return
+	}
+
+	var response UpdateConversationResponse
+	if done := doRequest(c, http.MethodPatch, "/conversation/"+c.Param("id"), request, &response); done {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func GenerateTitle(c *gin.Context) {
+	var request GenerateTitleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+	if request.MessageID == "" {
+		api.AbortWithParamError(c, http.StatusBadRequest, emptyMessageIDErrorMessage, "message_id")
+		return
+	}
+
+	var response GenerateTitleResponse
+	if done := doRequest(c, http.MethodPost, "/conversation/gen_title/"+c.Param("id"), request, &response); done {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ShareConversation creates a share link, the current node is used unless current_node_id is given.
+func ShareConversation(c *gin.Context) {
+	var request ShareConversationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+			return
+		}
+	}
+	request.ConversationID = c.Param("id")
+	if request.CurrentNodeID == "" {
+		conversation, done := getConversation(c, request.ConversationID)
+		if done {
+			return
+		}
+		request.CurrentNodeID = conversation.CurrentNode
+	}
+
+	var response ShareConversationResponse
+	if done := doRequest(c, http.MethodPost, "/share/create", request, &response); done {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func getConversation(c *gin.Context, id string) (*Conversation, bool) {
+	var conversation Conversation
+	if done := doRequest(c, http.MethodGet, "/conversation/"+id, nil, &conversation); done {
+		return nil, true
+	}
+	if conversation.ConversationID == "" {
+		conversation.ConversationID = id
+	}
+	return &conversation, false
+}
+
+func bindUpdateConversationRequest(c *gin.Context) (*UpdateConversationRequest, bool) {
+	var request UpdateConversationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return nil, true
+	}
+	if request.Title == nil && request.IsVisible == nil {
+		api.AbortWithError(c, http.StatusBadRequest, emptyUpdateErrorMessage)
+		return nil, true
+	}
+	if request.Title != nil && *request.Title == "" {
+		api.AbortWithParamError(c, http.StatusBadRequest, emptyTitleErrorMessage, "title")
+		return nil, true
+	}
+	return &request, false
+}
+
+// relayJSON checks that the upstream response has the shape of v, but writes it unchanged so that
+// fields the structs do not declare reach the client too.
+func relayJSON(c *gin.Context, response json.RawMessage, v any) {
+	if err := json.Unmarshal(response, v); err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, parseUpstreamResponseErrorMessage)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", response)
+}
+
+// doRequest calls the chatgpt backend api and decodes the json response into v, aborting on failure.
+func doRequest(c *gin.Context, method string, path string, body any, v any) bool {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, method, api.ChatGPTApiUrlPrefix+"/backend-api"+path, reader)
+	req.Header.Set("User-Agent", api.UserAgent)
+	req.Header.Set(api.AuthorizationHeader, api.GetAccessToken(c))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if puid := api.GetPUID(); puid != "" {
+		req.Header.Set("Cookie", "_puid="+puid)
+	}
+	resp, err := api.GetClient(api.ProviderChatGPT).Do(req)
+	if err != nil {
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
+		return true
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
+		}
+		api.AbortWithUpstreamResponse(c, resp)
+		return true
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, parseUpstreamResponseErrorMessage)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package chatgpt
+
+import (
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/backend"
+)
+
+var unsafeFilenameRegexp = regexp.MustCompile(`[^\p{L}\p{N}._ -]+`)
+
+// ExportConversation exports the current branch of a conversation as markdown, a json transcript
+// or an openai chat completions request that can be replayed through /imitate.
+func ExportConversation(c *gin.Context) {
+	format := c.DefaultQuery("format", exportFormatMarkdown)
+	if format != exportFormatMarkdown && format != exportFormatJson && format != exportFormatOpenAI {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidExportFormatErrorMessage, "format")
+		return
+	}
+
+	conversation, done := getConversation(c, c.Param("id"))
+	if done {
+		return
+	}
+
+	switch format {
+	case exportFormatMarkdown:
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": conversation.filename() + ".md"}))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(conversation.Markdown()))
+	case exportFormatJson:
+		c.JSON(http.StatusOK, conversation.Transcript())
+	case exportFormatOpenAI:
+		c.JSON(http.StatusOK, ExportedChatCompletionRequest{Model: conversation.model(), Messages: conversation.OpenAIMessages()})
+	}
+}
+
+// Thread walks from the current node back to the root and returns the visible messages in order.
+// Other branches (edited prompts, regenerated answers) are left out.
+func (conversation *Conversation) Thread() []ConversationMessage {
+	var messages []ConversationMessage
+	visited := map[string]bool{}
+	for id := conversation.CurrentNode; id != "" && !visited[id]; {
+		visited[id] = true
+		node, ok := conversation.Mapping[id]
+		if !ok {
+			break
+		}
+		if node.Message != nil && node.Message.visible() {
+			messages = append(messages, *node.Message)
+		}
+		if node.Parent == nil {
+			break
+		}
+		id = *node.Parent
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// OpenAIMessages exports the current thread as linear OpenAI chat messages.
+func (conversation *Conversation) OpenAIMessages() []backend.ChatMessage {
+	messages := []backend.ChatMessage{}
+	for _, message := range conversation.Thread() {
+		messages = append(messages, backend.ChatMessage{Role: message.Author.Role, Content: message.Text()})
+	}
+	return messages
+}
+
+// Markdown renders the current thread with a heading per message.
+func (conversation *Conversation) Markdown() string {
+	var builder strings.Builder
+	title := conversation.Title
+	if title == "" {
+		title = conversation.ConversationID
+	}
+	builder.WriteString("# " + title + "\n\n")
+	if conversation.CreateTime > 0 {
+		builder.WriteString("_" + formatTime(conversation.CreateTime) + "_\n\n")
+	}
+
+	for _, message := range conversation.Thread() {
+		builder.WriteString("## " + strings.ToUpper(message.Author.Role[:1]) + message.Author.Role[1:] + "\n\n")
+		builder.WriteString(strings.TrimSpace(message.Text()) + "\n\n")
+	}
+	return builder.String()
+}
+
+// Transcript flattens the current thread into a list of messages.
+func (conversation *Conversation) Transcript() ExportedConversation {
+	transcript := ExportedConversation{
+		ID:         conversation.ConversationID,
+		Title:      conversation.Title,
+		Model:      conversation.model(),
+		CreateTime: conversation.CreateTime,
+		UpdateTime: conversation.UpdateTime,
+		Messages:   []ExportedMessage{},
+	}
+	for _, message := range conversation.Thread() {
+		model, _ := message.Metadata["model_slug"].(string)
+		transcript.Messages = append(transcript.Messages, ExportedMessage{
+			ID:         message.ID,
+			Role:       message.Author.Role,
+			Content:    message.Text(),
+			Model:      model,
+			CreateTime: message.CreateTime,
+		})
+	}
+	return transcript
+}
+
+func (conversation *Conversation) model() string {
+	if conversation.DefaultModelSlug != "" {
+		return conversation.DefaultModelSlug
+	}
+
+	thread := conversation.Thread()
+	for i := len(thread) - 1; i >= 0; i-- {
+		if model, ok := thread[i].Metadata["model_slug"].(string); ok && model != "" {
+			return model
+		}
+	}
+	return ""
+}
+
+func (conversation *Conversation) filename() string {
+	filename := strings.Join(strings.Fields(unsafeFilenameRegexp.ReplaceAllString(conversation.Title, "")), " ")
+	if filename == "" {
+		return conversation.ConversationID
+	}
+	return filename
+}
+
+func formatTime(seconds float64) string {
+	return time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+}
+
+// Text returns the text parts of a message, attachments such as images are skipped.
+func (message *ConversationMessage) Text() string {
+	if message.Content.Text != "" {
+		return message.Content.Text
+	}
+
+	var parts []string
+	for _, part := range message.Content.Parts {
+		if text, ok := part.(string); ok && text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// visible drops tool traffic (browsing, code interpreter, plugins) and hidden system prompts.
+func (message *ConversationMessage) visible() bool {
+	if hidden, _ := message.Metadata["is_visually_hidden_from_conversation"].(bool); hidden {
+		return false
+	}
+	if message.Recipient != "" && message.Recipient != "all" {
+		return false
+	}
+
+	switch message.Author.Role {
+	case "user", "assistant":
+		return message.Content.ContentType == "text" || message.Content.ContentType == "multimodal_text"
+	case "system":
+		return message.Text() != ""
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package chatgpt
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/validation"
+)
+
+// UploadAttachment runs the file upload handshake (create, upload, confirm) for a multipart "file"
+// and returns the attachment reference to put in a message.
+func UploadAttachment(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		api.AbortWithParamError(c, http.StatusBadRequest, missingFileErrorMessage, "file")
+		return
+	}
+
+	maxBodySize := validation.MaxBodySize()
+	if fileHeader.Size > maxBodySize {
+		api.Abort(c, http.StatusRequestEntityTooLarge, validation.BodyTooLarge(maxBodySize))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(filepath.Ext(fileHeader.Filename)); byExtension != "" {
+			mimeType = byExtension
+		} else {
+			mimeType = http.DetectContentType(data)
+		}
+	}
+
+	attachment, ok := uploadFile(c, fileHeader.Filename, mimeType, data)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+func uploadFile(c *gin.Context, name string, mimeType string, data []byte) (*Attachment, bool) {
+	attachment := &Attachment{
+		Name:     name,
+		Size:     int64(len(data)),
+		MimeType: mimeType,
+	}
+
+	useCase := fileUseCaseMyFiles
+	if strings.HasPrefix(mimeType, "image/") {
+		useCase = fileUseCaseMultimodal
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			attachment.Width = config.Width
+			attachment.Height = config.Height
+		}
+	}
+
+	var created CreateFileResponse
+	if doRequest(c, http.MethodPost, "/files", CreateFileRequest{
+		FileName: name,
+		FileSize: attachment.Size,
+		UseCase:  useCase,
+	}, &created) {
+		return nil, false
+	}
+	if created.Status != "success" || created.UploadURL == "" {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(createFileErrorMessage, created.ErrorCode))
+		return nil, false
+	}
+	attachment.ID = created.FileID
+
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, http.MethodPut, created.UploadURL, bytes.NewReader(data))
+	req.Header.Set("User-Agent", api.UserAgent)
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", "2020-04-08")
+	resp, err := api.GetClient(api.ProviderChatGPT).Do(req)
+	if err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(uploadFileErrorMessage, api.UpstreamCause(req, err).Error()))
+		return nil, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(uploadFileErrorMessage, resp.Status))
+		return nil, false
+	}
+
+	var uploaded UploadedFileResponse
+	if doRequest(c, http.MethodPost, "/files/"+attachment.ID+"/uploaded", map[string]string{}, &uploaded) {
+		return nil, false
+	}
+	if uploaded.Status != "success" {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(confirmUploadErrorMessage, uploaded.ErrorCode))
+		return nil, false
+	}
+
+	return attachment, true
+}
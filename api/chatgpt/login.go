@@ -1,27 +1,53 @@
 package chatgpt
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	http "github.com/bogdanfinn/fhttp"
 	"github.com/gin-gonic/gin"
 	"github.com/xqdoo00o/OpenAIAuth/auth"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/session"
 )
 
 func Login(c *gin.Context) {
 	var loginInfo api.LoginInfo
 	if err := c.ShouldBindJSON(&loginInfo); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(api.ParseUserInfoErrorMessage))
+		api.AbortWithError(c, http.StatusBadRequest, api.ParseUserInfoErrorMessage)
 		return
 	}
 
-	authenticator := auth.NewAuthenticator(loginInfo.Username, loginInfo.Password, api.ProxyUrl)
+	authenticator := auth.NewAuthenticator(loginInfo.Username, loginInfo.Password, api.GetClientConfig(api.ProviderChatGPT).Proxy)
 	if err := authenticator.Begin(); err != nil {
-		c.AbortWithStatusJSON(err.StatusCode, api.ReturnMessage(err.Details))
+		api.AbortWithError(c, err.StatusCode, err.Details)
 		return
 	}
 
+	s := session.DefaultStore.Create(session.ProviderChatGPT, loginInfo.Username, authenticator.GetAccessToken(), "", time.Time{}, refreshSession(authenticator))
 	c.JSON(http.StatusOK, gin.H{
-		"accessToken": authenticator.GetAccessToken(),
+		"accessToken": s.AccessToken,
+		"sessionKey":  s.Key,
+		"expiresAt":   s.ExpiresAt,
 	})
 }
+
+// refreshSession reuses the auth session cookie of the login, and logs in again once that is gone.
+func refreshSession(authenticator *auth.UserLogin) session.Refresher {
+	return func(_ context.Context, s *session.Session) error {
+		accessToken, _, err := authenticator.GetAccessTokenInternal("")
+		if err == nil {
+			s.AccessToken = accessToken
+			return nil
+		}
+
+		authenticator.ResetCookies()
+		if err := authenticator.Begin(); err != nil {
+			return errors.New(err.Details)
+		}
+		s.AccessToken = authenticator.GetAccessToken()
+		return nil
+	}
+}
@@ -2,6 +2,8 @@ package chatgpt
 
 import (
 	"github.com/google/uuid"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
 )
 
 type CreateConversationRequest struct {
@@ -15,6 +17,7 @@ type CreateConversationRequest struct {
 	ArkoseToken                string    `json:"arkose_token"`
 	HistoryAndTrainingDisabled bool      `json:"history_and_training_disabled"`
 	AutoContinue               bool      `json:"auto_continue"`
+	MaxContinuations           *int      `json:"max_continuations,omitempty"`
 	Suggestions                []string  `json:"suggestions"`
 }
 
@@ -27,6 +30,31 @@ func (c *CreateConversationRequest) AddMessage(role string, content string) {
 	})
 }
 
+func (c *CreateConversationRequest) AddMessageWithAttachments(role string, content string, attachments []Attachment) {
+	c.Messages = append(c.Messages, Message{
+		ID:       uuid.New().String(),
+		Author:   Author{Role: role},
+		Content:  Content{ContentType: "text", Parts: []interface{}{content}},
+		Metadata: map[string]interface{}{"attachments": attachments},
+	})
+}
+
+// AddImageMessage puts the images in front of the text as multimodal parts, the way the web client sends them.
+func (c *CreateConversationRequest) AddImageMessage(role string, content string, images []Attachment) {
+	parts := make([]interface{}, 0, len(images)+1)
+	for _, image := range images {
+		parts = append(parts, image.ImagePart())
+	}
+	parts = append(parts, content)
+
+	c.Messages = append(c.Messages, Message{
+		ID:       uuid.New().String(),
+		Author:   Author{Role: role},
+		Content:  Content{ContentType: contentTypeMultimodalText, Parts: parts},
+		Metadata: map[string]interface{}{"attachments": images},
+	})
+}
+
 type Message struct {
 	Author   Author      `json:"author"`
 	Content  Content     `json:"content"`
@@ -94,3 +122,166 @@ type GetModelsResponse struct {
 		PluginsModel         string `json:"plugins_model"`
 	} `json:"categories"`
 }
+
+type GetConversationsResponse struct {
+	Items                   []ConversationItem `json:"items"`
+	Total                   int                `json:"total"`
+	Limit                   int                `json:"limit"`
+	Offset                  int                `json:"offset"`
+	HasMissingConversations bool               `json:"has_missing_conversations"`
+}
+
+type ConversationItem struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	CreateTime string `json:"create_time"`
+	UpdateTime string `json:"update_time"`
+	IsArchived bool   `json:"is_archived"`
+}
+
+type Conversation struct {
+	ConversationID   string                      `json:"conversation_id"`
+	Title            string                      `json:"title"`
+	CreateTime       float64                     `json:"create_time"`
+	UpdateTime       float64                     `json:"update_time"`
+	Mapping          map[string]ConversationNode `json:"mapping"`
+	CurrentNode      string                      `json:"current_node"`
+	IsArchived       bool                        `json:"is_archived"`
+	DefaultModelSlug string                      `json:"default_model_slug,omitempty"`
+}
+
+type ConversationNode struct {
+	ID       string               `json:"id"`
+	Message  *ConversationMessage `json:"message"`
+	Parent   *string              `json:"parent"`
+	Children []string             `json:"children"`
+}
+
+type ConversationMessage struct {
+	ID         string                 `json:"id"`
+	Author     ConversationAuthor     `json:"author"`
+	CreateTime *float64               `json:"create_time"`
+	UpdateTime *float64               `json:"update_time"`
+	Content    ConversationContent    `json:"content"`
+	Status     string                 `json:"status"`
+	EndTurn    *bool                  `json:"end_turn"`
+	Weight     float64                `json:"weight"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Recipient  string                 `json:"recipient"`
+}
+
+type ConversationAuthor struct {
+	Role     string                 `json:"role"`
+	Name     *string                `json:"name"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type ConversationContent struct {
+	ContentType string        `json:"content_type"`
+	Parts       []interface{} `json:"parts,omitempty"`
+	Text        string        `json:"text,omitempty"`
+	Language    string        `json:"language,omitempty"`
+}
+
+type UpdateConversationRequest struct {
+	Title     *string `json:"title,omitempty"`
+	IsVisible *bool   `json:"is_visible,omitempty"`
+}
+
+type UpdateConversationResponse struct {
+	Success bool `json:"success"`
+}
+
+type GenerateTitleRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+type GenerateTitleResponse struct {
+	Title string `json:"title"`
+}
+
+type ShareConversationRequest struct {
+	ConversationID string `json:"conversation_id"`
+	CurrentNodeID  string `json:"current_node_id"`
+	IsAnonymous    bool   `json:"is_anonymous"`
+}
+
+type ShareConversationResponse struct {
+	ShareID            string `json:"share_id"`
+	ShareURL           string `json:"share_url"`
+	Title              string `json:"title"`
+	IsPublic           bool   `json:"is_public"`
+	IsVisible          bool   `json:"is_visible"`
+	IsAnonymous        bool   `json:"is_anonymous"`
+	HighlightedMessage any    `json:"highlighted_message_id"`
+	AlreadyExists      bool   `json:"already_exists"`
+	ModerationState    any    `json:"moderation_state"`
+}
+
+type ExportedConversation struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Model      string            `json:"model,omitempty"`
+	CreateTime float64           `json:"create_time"`
+	UpdateTime float64           `json:"update_time"`
+	Messages   []ExportedMessage `json:"messages"`
+}
+
+type ExportedMessage struct {
+	ID         string   `json:"id"`
+	Role       string   `json:"role"`
+	Content    string   `json:"content"`
+	Model      string   `json:"model,omitempty"`
+	CreateTime *float64 `json:"create_time,omitempty"`
+}
+
+type ExportedChatCompletionRequest struct {
+	Model    string                `json:"model,omitempty"`
+	Messages []backend.ChatMessage `json:"messages"`
+}
+
+type Attachment struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+func (a Attachment) ImagePart() ImagePart {
+	return ImagePart{
+		ContentType:  contentTypeImageAsset,
+		AssetPointer: fileServicePrefix + a.ID,
+		SizeBytes:    a.Size,
+		Width:        a.Width,
+		Height:       a.Height,
+	}
+}
+
+type ImagePart struct {
+	ContentType  string `json:"content_type"`
+	AssetPointer string `json:"asset_pointer"`
+	SizeBytes    int64  `json:"size_bytes"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type CreateFileRequest struct {
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+	UseCase  string `json:"use_case"`
+}
+
+type CreateFileResponse struct {
+	Status    string `json:"status"`
+	UploadURL string `json:"upload_url"`
+	FileID    string `json:"file_id"`
+	ErrorCode string `json:"error_code"`
+}
+
+type UploadedFileResponse struct {
+	Status      string `json:"status"`
+	DownloadURL string `json:"download_url"`
+	ErrorCode   string `json:"error_code"`
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// HttpClient is what the handlers need from an upstream client, tls-client and plain clients both provide it.
+type HttpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+	CloseIdleConnections()
+}
+
+// ClientConfig describes the client of one provider, HTTP_CLIENTS_FILE maps provider names to it.
+type ClientConfig struct {
+	// "tls" fingerprints the TLS hello with TLSProfile, "plain" uses a regular client
+	Type       string `json:"type"`
+	Proxy      string `json:"proxy"`
+	TLSProfile string `json:"tls_profile"`
+	// PEM bundle trusted in addition to the system roots
+	CAFile       string `json:"ca_file"`
+	MaxConns     int    `json:"max_conns"`
+	MaxIdleConns int    `json:"max_idle_conns"`
+	// durations like "10s", override the <PROVIDER>_*_TIMEOUT environment variables
+	ConnectTimeout   string `json:"connect_timeout"`
+	FirstByteTimeout string `json:"first_byte_timeout"`
+	TotalTimeout     string `json:"total_timeout"`
+}
+
+var (
+	clients   = map[string]HttpClient{}
+	clientsMu sync.Mutex
+
+	clientConfigs     map[string]ClientConfig
+	clientConfigsOnce sync.Once
+)
+
+// GetClient returns the shared client of provider, built on first use.
+func GetClient(provider string) HttpClient {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if client, ok := clients[provider]; ok {
+		return client
+	}
+
+	client, err := NewClient(GetClientConfig(provider))
+	if err != nil {
+		logger.Error(fmt.Sprintf(createClientErrorMessage, provider, err.Error()))
+		client, _ = NewClient(ClientConfig{})
+	}
+	clients[provider] = upstreamClient{client}
+	return clients[provider]
+}
+
+// NewSessionClient returns a new tls-client with its own cookie jar, for login flows that depend on cookies.
+func NewSessionClient(provider string) tls_client.HttpClient {
+	config := GetClientConfig(provider)
+	client, err := newTLSClient(config, tls_client.WithCookieJar(tls_client.NewCookieJar()))
+	if err != nil {
+		logger.Error(fmt.Sprintf(createClientErrorMessage, provider, err.Error()))
+		client, _ = newTLSClient(ClientConfig{}, tls_client.WithCookieJar(tls_client.NewCookieJar()))
+	}
+	return sessionClient{client}
+}
+
+// GetClientConfig merges the entry of provider from HTTP_CLIENTS_FILE over the defaults:
+// a tls-client with the okhttp profile, plain for the providers that do not check fingerprints, and PROXY for all.
+func GetClientConfig(provider string) ClientConfig {
+	clientConfigsOnce.Do(loadClientConfigs)
+
+	config := ClientConfig{
+		Type:       clientTypeTLS,
+		Proxy:      os.Getenv("PROXY"),
+		TLSProfile: defaultTLSProfile,
+	}
+	if provider == ProviderCopilot || provider == ProviderPatsnap {
+		config.Type = clientTypePlain
+	}
+
+	for _, name := range []string{defaultClientConfigName, provider} {
+		override, ok := clientConfigs[name]
+		if !ok {
+			continue
+		}
+		if override.Type != "" {
+			config.Type = override.Type
+		}
+		if override.Proxy != "" {
+			config.Proxy = override.Proxy
+		}
+		if override.TLSProfile != "" {
+			config.TLSProfile = override.TLSProfile
+		}
+		if override.CAFile != "" {
+			config.CAFile = override.CAFile
+		}
+		if override.MaxConns != 0 {
+			config.MaxConns = override.MaxConns
+		}
+		if override.MaxIdleConns != 0 {
+			config.MaxIdleConns = override.MaxIdleConns
+		}
+		if override.ConnectTimeout != "" {
+			config.ConnectTimeout = override.ConnectTimeout
+		}
+		if override.FirstByteTimeout != "" {
+			config.FirstByteTimeout = override.FirstByteTimeout
+		}
+		if override.TotalTimeout != "" {
+			config.TotalTimeout = override.TotalTimeout
+		}
+	}
+	// "direct" turns the global proxy off for one provider
+	if config.Proxy == directProxy {
+		config.Proxy = ""
+	}
+	return config
+}
+
+func loadClientConfigs() {
+	clientConfigs = map[string]ClientConfig{}
+
+	path := os.Getenv("HTTP_CLIENTS_FILE")
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &clientConfigs)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf(loadClientConfigsErrorMessage, path, err.Error()))
+	}
+}
+
+func NewClient(config ClientConfig) (HttpClient, error) {
+	switch config.Type {
+	case clientTypeTLS, "":
+		// shared cookies keep cloudflare clearance between requests
+		return newTLSClient(config, tls_client.WithCookieJar(tls_client.NewCookieJar()))
+	case clientTypePlain:
+		return newPlainClient(config)
+	default:
+		return nil, fmt.Errorf(unknownClientTypeErrorMessage, config.Type)
+	}
+}
+
+func newTLSClient(config ClientConfig, options ...tls_client.HttpClientOption) (tls_client.HttpClient, error) {
+	profileName := config.TLSProfile
+	if profileName == "" {
+		profileName = defaultTLSProfile
+	}
+	profile, ok := profiles.MappedTLSClients[profileName]
+	if !ok {
+		return nil, fmt.Errorf(unknownTLSProfileErrorMessage, profileName)
+	}
+
+	rootCAs, err := loadRootCAs(config.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	options = append(options,
+		tls_client.WithClientProfile(profile),
+		// the timeouts are applied per request, see NewUpstreamRequest
+		tls_client.WithTimeoutMilliseconds(0),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{
+			MaxConnsPerHost:     config.MaxConns,
+			MaxIdleConns:        config.MaxIdleConns,
+			MaxIdleConnsPerHost: config.MaxIdleConns,
+			RootCAs:             rootCAs,
+		}),
+	)
+	if config.Proxy != "" {
+		options = append(options, tls_client.WithProxyUrl(config.Proxy))
+	}
+
+	return tls_client.NewHttpClient(tls_client.NewNoopLogger(), options...)
+}
+
+func newPlainClient(config ClientConfig) (*http.Client, error) {
+	rootCAs, err := loadRootCAs(config.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// like the tls-client, only PROXY and the config decide the proxy, HTTP(S)_PROXY are not consulted,
+	// so "direct" really goes direct
+	transport := &http.Transport{
+		DialContext:         (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:     &tls.Config{RootCAs: rootCAs},
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+		MaxConnsPerHost:     config.MaxConns,
+		MaxIdleConns:        config.MaxIdleConns,
+		MaxIdleConnsPerHost: config.MaxIdleConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if config.Proxy != "" {
+		proxyUrl, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}, nil
+}
+
+// timeouts overrides the given durations with the configured ones.
+func (config ClientConfig) timeouts(fallback Timeouts) Timeouts {
+	timeouts := fallback
+	for _, t := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{config.ConnectTimeout, &timeouts.Connect},
+		{config.FirstByteTimeout, &timeouts.FirstByte},
+		{config.TotalTimeout, &timeouts.Total},
+	} {
+		if duration, err := time.ParseDuration(t.value); err == nil && duration >= 0 {
+			*t.target = duration
+		}
+	}
+	return timeouts
+}
+
+// loadRootCAs adds the certificates of path to the system roots, an empty path keeps the system roots.
+func loadRootCAs(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf(invalidCAFileErrorMessage, path)
+	}
+	return pool, nil
+}
@@ -1,21 +1,14 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
-	"fmt"
 	"io"
-	"os"
 	"strings"
 	"time"
 
 	http "github.com/bogdanfinn/fhttp"
-	tls_client "github.com/bogdanfinn/tls-client"
-	"github.com/bogdanfinn/tls-client/profiles"
 	"github.com/gin-gonic/gin"
-	"github.com/xqdoo00o/OpenAIAuth/auth"
-	"github.com/xqdoo00o/funcaptcha"
 
 	"github.com/linweiyuan/go-logger/logger"
 )
@@ -29,8 +22,15 @@ const (
 	PlatformApiUrlPrefix = "https://api.openai.com"
 
 	defaultErrorMessageKey             = "errorMessage"
+	invalidRequestErrorType            = "invalid_request_error"
+	authenticationErrorType            = "authentication_error"
+	permissionErrorType                = "permission_error"
+	rateLimitErrorType                 = "rate_limit_error"
+	serverErrorType                    = "server_error"
 	AuthorizationHeader                = "Authorization"
 	XAuthorizationHeader               = "X-Authorization"
+	XGoogApiKeyHeader                  = "X-Goog-Api-Key"
+	XRequestIdHeader                   = "X-Request-Id"
 	ContentType                        = "application/x-www-form-urlencoded"
 	UserAgent                          = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0"
 	Auth0Url                           = "https://auth0.openai.com"
@@ -41,127 +41,91 @@ const (
 	EmailInvalidErrorMessage           = "email is not valid"
 	EmailOrPasswordInvalidErrorMessage = "email or password is not correct"
 	GetAccessTokenErrorMessage         = "failed to get access token"
-	defaultTimeoutSeconds              = 600 // 10 minutes
+	ProviderChatGPT                    = "chatgpt"
+	ProviderPlatform                   = "platform"
+	ProviderCopilot                    = "copilot"
+	ProviderPatsnap                    = "patsnap"
+	ProviderArkose                     = "arkose"
+	// requests forwarded by Proxy
+	ProviderProxy = "proxy"
+
+	defaultConnectTimeout       = 10 * time.Second
+	defaultFirstByteTimeout     = 2 * time.Minute
+	defaultTotalTimeout         = 10 * time.Minute
+	upstreamTimeoutErrorMessage = "upstream %s timeout of %s exceeded"
+
+	clientTypeTLS                 = "tls"
+	clientTypePlain               = "plain"
+	defaultTLSProfile             = "okhttp4_android_13"
+	defaultClientConfigName       = "default"
+	directProxy                   = "direct"
+	createClientErrorMessage      = "failed to create http client for %s: %s"
+	loadClientConfigsErrorMessage = "failed to load http clients from %s: %s"
+	unknownClientTypeErrorMessage = "unknown http client type: %s"
+	unknownTLSProfileErrorMessage = "unknown tls profile: %s"
+	invalidCAFileErrorMessage     = "no certificates found in %s"
 
 	EmailKey                       = "email"
+	RequestIdKey                   = "requestId"
 	AccountDeactivatedErrorMessage = "account %s is deactivated"
 	AccountForbiddenErrorMessage   = "account %s is forbidden"
 
 	ReadyHint = "service go-chatgpt-api is ready"
 
-	refreshPuidErrorMessage = "failed to refresh PUID"
+	refreshPuidErrorMessage        = "failed to refresh PUID of %s: %s, retrying in %s"
+	puidCookieNotFoundErrorMessage = "PUID cookie not found"
+	defaultPuidLifetime            = 7 * 24 * time.Hour
+	puidRefreshBefore              = time.Hour
+	puidMinBackoff                 = 30 * time.Second
+	puidMaxBackoff                 = time.Hour
+	accountExistsErrorMessage      = "account %s already exists"
+	accountNotFoundErrorMessage    = "account %s not found"
+	missingParamErrorMessage       = "missing required parameter: '%s'"
+
+	arkoseProviderFuncaptcha           = "funcaptcha"
+	arkoseProviderHar                  = "har"
+	arkoseProviderSolver               = "solver"
+	arkoseProviderPool                 = "pool"
+	defaultArkoseHarFile               = "chat.openai.com.har"
+	defaultArkoseTokenTTL              = 2 * time.Minute
+	arkoseUrlPrefix                    = "https://tcr9i.chat.openai.com/fc/gt2/"
+	arkoseChatPublicKey                = "35536E1E-65B4-4D96-9D97-6ADB7EFF8147"
+	arkoseBwWindow                     = 21600 // 6 hours, the fingerprint key rotates with it
+	emptyArkoseTokenErrorMessage       = "arkose provider returned an empty token"
+	emptyArkoseTokenPoolErrorMessage   = "arkose token pool is empty"
+	missingArkoseTokensErrorMessage    = "missing required parameter: 'tokens'"
+	missingArkoseSolverUrlErrorMessage = "ARKOSE_SOLVER_URL is not configured"
+	arkoseSolverErrorMessage           = "arkose solver returned %s: %s"
+	arkoseHarReplayErrorMessage        = "arkose replay returned %s"
+	invalidHarFileErrorMessage         = "%s is not a valid HAR file: %s"
+	noArkoseRequestInHarErrorMessage   = "no arkose request for chat.openai.com found in %s"
+
+	defaultProxyRoutes          = ChatGPTApiPrefix + "=" + ChatGPTApiUrlPrefix + "," + ImitateApiPrefix + "=" + ChatGPTApiUrlPrefix + "/backend-api," + PlatformApiPrefix + "=" + PlatformApiUrlPrefix
+	defaultProxyRequestHeaders  = "Accept,Accept-Language,Content-Type,OpenAI-Beta,OpenAI-Organization,OpenAI-Project,Oai-Device-Id,Oai-Language"
+	defaultProxyResponseHeaders = "Content-Type,Content-Disposition,Cache-Control,Retry-After,X-Request-Id,OpenAI-Processing-Ms,OpenAI-Version,X-Ratelimit-Limit-Requests,X-Ratelimit-Limit-Tokens,X-Ratelimit-Remaining-Requests,X-Ratelimit-Remaining-Tokens,X-Ratelimit-Reset-Requests,X-Ratelimit-Reset-Tokens"
+	noProxyRouteErrorMessage    = "no upstream is configured for %s"
 
 	Version = "2024.06.18.1"
 )
 
-var (
-	Client       tls_client.HttpClient
-	ArkoseClient tls_client.HttpClient
-	PUID         string
-	ProxyUrl     string
-)
-
 type LoginInfo struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
 type AuthLogin interface {
-	GetAuthorizedUrl(csrfToken string) (string, int, error)
+	GetAuthorizedUrl(ctx context.Context, csrfToken string) (string, int, error)
 	GetState(authorizedUrl string) (string, int, error)
-	CheckUsername(state string, username string) (int, error)
-	CheckPassword(state string, username string, password string) (string, int, error)
-	GetAccessToken(code string) (string, int, error)
+	CheckUsername(ctx context.Context, state string, username string) (int, error)
+	CheckPassword(ctx context.Context, state string, username string, password string) (string, int, error)
+	GetAccessToken(ctx context.Context, code string) (string, int, error)
 	GetAccessTokenFromHeader(c *gin.Context) (string, int, error)
 }
 
 func init() {
-	Client, _ = tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
-		tls_client.WithCookieJar(tls_client.NewCookieJar()),
-		tls_client.WithTimeoutSeconds(defaultTimeoutSeconds),
-		tls_client.WithClientProfile(profiles.Okhttp4Android13),
-	}...)
-	ArkoseClient = getHttpClient()
-
 	setupPUID()
 }
 
-func NewHttpClient() tls_client.HttpClient {
-	client := getHttpClient()
-
-	ProxyUrl = os.Getenv("PROXY")
-	if ProxyUrl != "" {
-		client.SetProxy(ProxyUrl)
-	}
-
-	return client
-}
-
-func getHttpClient() tls_client.HttpClient {
-	client, _ := tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
-		tls_client.WithCookieJar(tls_client.NewCookieJar()),
-		tls_client.WithClientProfile(profiles.Okhttp4Android13),
-	}...)
-	return client
-}
-
-func Proxy(c *gin.Context) {
-	url := c.Request.URL.Path
-	if strings.Contains(url, ChatGPTApiPrefix) {
-		url = strings.ReplaceAll(url, ChatGPTApiPrefix, ChatGPTApiUrlPrefix)
-	} else if strings.Contains(url, ImitateApiPrefix) {
-		url = strings.ReplaceAll(url, ImitateApiPrefix, ChatGPTApiUrlPrefix+"/backend-api")
-	} else {
-		url = strings.ReplaceAll(url, PlatformApiPrefix, PlatformApiUrlPrefix)
-	}
-
-	method := c.Request.Method
-	queryParams := c.Request.URL.Query().Encode()
-	if queryParams != "" {
-		url += "?" + queryParams
-	}
-
-	// if not set, will return 404
-	c.Status(http.StatusOK)
-
-	var req *http.Request
-	if method == http.MethodGet {
-		req, _ = http.NewRequest(http.MethodGet, url, nil)
-	} else {
-		body, _ := io.ReadAll(c.Request.Body)
-		req, _ = http.NewRequest(method, url, bytes.NewReader(body))
-	}
-	req.Header.Set("User-Agent", UserAgent)
-	req.Header.Set(AuthorizationHeader, GetAccessToken(c))
-	resp, err := Client.Do(req)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ReturnMessage(err.Error()))
-		return
-	}
-
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusUnauthorized {
-			logger.Error(fmt.Sprintf(AccountDeactivatedErrorMessage, c.GetString(EmailKey)))
-		}
-
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
-		return
-	}
-
-	io.Copy(c.Writer, resp.Body)
-}
-
-func ReturnMessage(msg string) gin.H {
-	logger.Warn(msg)
-
-	return gin.H{
-		defaultErrorMessageKey: msg,
-	}
-}
-
 func GetAccessToken(c *gin.Context) string {
 	accessToken := c.GetString(AuthorizationHeader)
 	if !strings.HasPrefix(accessToken, "Bearer") {
@@ -171,10 +135,6 @@ func GetAccessToken(c *gin.Context) string {
 	return accessToken
 }
 
-func GetArkoseToken() (string, error) {
-	return funcaptcha.GetOpenAIToken(PUID, ProxyUrl)
-}
-
 func GetBearerRemovedToken(c *gin.Context) string {
 	accessToken := c.GetString(AuthorizationHeader)
 	if strings.HasPrefix(accessToken, "Bearer") {
@@ -215,41 +175,9 @@ func GetGithubToken(c *gin.Context) string {
 	return token
 }
 
-func setupPUID() {
-	username := os.Getenv("OPENAI_EMAIL")
-	password := os.Getenv("OPENAI_PASSWORD")
-	if username != "" && password != "" {
-		go func() {
-			for {
-				authenticator := auth.NewAuthenticator(username, password, ProxyUrl)
-				if err := authenticator.Begin(); err != nil {
-					logger.Warn(fmt.Sprintf("%s: %s", refreshPuidErrorMessage, err.Details))
-					return
-				}
-
-				accessToken := authenticator.GetAccessToken()
-				if accessToken == "" {
-					logger.Error(refreshPuidErrorMessage)
-					return
-				}
-
-				puid, err := authenticator.GetPUID()
-				if err != nil {
-					logger.Error(refreshPuidErrorMessage)
-					return
-				}
-
-				PUID = puid
-
-				time.Sleep(time.Hour * 24 * 7)
-			}
-		}()
-	}
-}
-
-func GetImageBase64Str(url string) string {
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
-	resp, err := Client.Do(req)
+func GetImageBase64Str(ctx context.Context, url string) string {
+	req, _ := NewUpstreamRequest(ctx, ProviderPatsnap, http.MethodGet, url, nil)
+	resp, err := GetClient(ProviderPatsnap).Do(req)
 	if err != nil {
 		logger.Error(err.Error())
 		return ""
@@ -2,6 +2,7 @@ package copilot
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -17,6 +18,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/backend"
 	"github.com/linweiyuan/go-logger/logger"
 )
 
@@ -29,6 +31,7 @@ type CachedToken struct {
 
 var (
 	cached_tokens map[string]CachedToken = make(map[string]CachedToken)
+	cached_mutex  sync.RWMutex
 	machineId     string
 	once          sync.Once
 )
@@ -38,7 +41,10 @@ func CreateChatCompletions(c *gin.Context) {
 	var request struct {
 		Stream bool `json:"stream"`
 	}
-	json.Unmarshal(body, &request)
+	if err := json.Unmarshal(body, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
 
 	url := copilotChatCompletionsApi
 
@@ -48,11 +54,11 @@ func CreateChatCompletions(c *gin.Context) {
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusUnauthorized {
-		logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
+		}
+		api.AbortWithUpstreamResponse(c, resp)
 		return
 	}
 
@@ -64,14 +70,14 @@ func CreateChatCompletions(c *gin.Context) {
 }
 
 func CreateCompletions(c *gin.Context) {
-	CreateChatCompletions(c)
+	backend.CreateCompletions(c, CreateChatCompletions)
 }
 
 func handlePost(c *gin.Context, url string, data []byte, stream bool) (*http.Response, error) {
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderCopilot, http.MethodPost, url, bytes.NewBuffer(data))
 	req.Header.Set("Host", copilotApiHost)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set(api.AuthorizationHeader, "Bearer "+getToken(c.Request.Header.Get(api.AuthorizationHeader)))
+	req.Header.Set(api.AuthorizationHeader, "Bearer "+getToken(c.Request.Context(), c.Request.Header.Get(api.AuthorizationHeader)))
 	req.Header.Set("X-Request-Id", uuid.New().String())
 	req.Header.Set("X-Github-Api-Version", "2023-07-07")
 	req.Header.Set("Vscode-Sessionid", getSessionId())
@@ -88,41 +94,82 @@ func handlePost(c *gin.Context, url string, data []byte, stream bool) (*http.Res
 	// if stream {
 	// 	req.Header.Set("Accept", "text/event-stream")
 	// }
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderCopilot).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return nil, err
 	}
 	return resp, nil
 }
 
-func getToken(ghu_token string) string {
+func getToken(ctx context.Context, ghu_token string) string {
 	ghu_token = strings.TrimSpace(strings.TrimPrefix(ghu_token, "Bearer"))
+	cached_mutex.RLock()
 	value, exists := cached_tokens[ghu_token]
-	if exists && time.Since(value.fetched_at) < 15*time.Minute {
+	cached_mutex.RUnlock()
+	if exists && time.Since(value.fetched_at) < tokenCacheTTL {
 		return value.token
 	}
-	req, _ := http.NewRequest(http.MethodGet, githubCopilotTokenApi, nil)
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderCopilot, http.MethodGet, githubCopilotTokenApi, nil)
 	req.Header.Set("Host", githubApiHost)
 	req.Header.Set("authorization", "token "+ghu_token)
 	req.Header.Set("editor-version", "vscode/1.85.0")
 	req.Header.Set("editor-plugin-version", "copilot-chat/0.11.1")
 	req.Header.Set("user-agent", "GitHubCopilotChat/0.11.1")
 	req.Header.Set("accept", "*/*")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderCopilot).Do(req)
 	if err != nil {
 		return ""
 	}
 	defer resp.Body.Close()
 	responseMap := make(map[string]interface{})
 	json.NewDecoder(resp.Body).Decode(&responseMap)
+	cached_mutex.Lock()
 	cached_tokens[ghu_token] = CachedToken{
 		token:      responseMap["token"].(string),
 		fetched_at: time.Now(),
 	}
+	cached_mutex.Unlock()
 	return responseMap["token"].(string)
 }
 
+// GetCachedTokens lists the cached copilot tokens, github tokens are masked.
+func GetCachedTokens(c *gin.Context) {
+	cached_mutex.RLock()
+	entries := make([]gin.H, 0, len(cached_tokens))
+	for ghu_token, value := range cached_tokens {
+		entries = append(entries, gin.H{
+			"github_token": maskToken(ghu_token),
+			"fetched_at":   value.fetched_at,
+			"expired":      time.Since(value.fetched_at) >= tokenCacheTTL,
+		})
+	}
+	cached_mutex.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": entries,
+	})
+}
+
+// ClearCachedTokens makes every github token fetch a new copilot token on its next request.
+func ClearCachedTokens(c *gin.Context) {
+	cached_mutex.Lock()
+	cleared := len(cached_tokens)
+	cached_tokens = make(map[string]CachedToken)
+	cached_mutex.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"cleared": cleared,
+	})
+}
+
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return token[:4] + "****" + token[len(token)-4:]
+}
+
 func getSessionId() string {
 	myUuid := uuid.New().String()
 	now := time.Now()
@@ -1,10 +1,15 @@
 package copilot
 
+import "time"
+
 const (
 	copilotApiHost            = "api.githubcopilot.com"
 	copilotChatCompletionsApi = "https://" + copilotApiHost + "/chat/completions"
 	githubApiHost             = "api.github.com"
 	githubCopilotTokenApi     = "https://" + githubApiHost + "/copilot_internal/v2/token"
 
+	tokenCacheTTL = 15 * time.Minute
+
 	getSessionKeyErrorMessage = "failed to get session key"
+	parseJsonErrorMessage     = "failed to parse json request body"
 )
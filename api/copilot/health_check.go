@@ -0,0 +1,12 @@
+package copilot
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/health"
+)
+
+func init() {
+	health.Register(api.ProviderCopilot, health.ExpectStatus(api.ProviderCopilot, githubCopilotTokenApi, http.StatusUnauthorized))
+}
@@ -0,0 +1,21 @@
+package embeddings
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+func GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, DefaultCache.Stats())
+}
+
+func ClearCache(c *gin.Context) {
+	if err := DefaultCache.Clear(); err != nil {
+		api.AbortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, DefaultCache.Stats())
+}
@@ -0,0 +1,251 @@
+package embeddings
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// Cache maps content hash + model + dimensions to an embedding vector.
+// Entries are appended to a json lines file so that they survive restarts.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string][]float64
+	order   []string
+	maxSize int
+	path    string
+	file    *os.File
+
+	hits      int64
+	misses    int64
+	stores    int64
+	evictions int64
+}
+
+type CacheStats struct {
+	Enabled   bool    `json:"enabled"`
+	Path      string  `json:"path"`
+	Entries   int     `json:"entries"`
+	MaxSize   int     `json:"max_size"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	Stores    int64   `json:"stores"`
+	Evictions int64   `json:"evictions"`
+}
+
+type cacheRecord struct {
+	Key       string    `json:"key"`
+	Embedding []float64 `json:"embedding"`
+}
+
+var DefaultCache = NewCache(os.Getenv("EMBEDDING_CACHE_FILE"), cacheSize())
+
+func cacheSize() int {
+	size, err := strconv.Atoi(os.Getenv("EMBEDDING_CACHE_SIZE"))
+	if err != nil {
+		return defaultCacheSize
+	}
+	return size
+}
+
+// NewCache loads path if it exists, a negative maxSize disables the cache and an empty path keeps it in memory.
+func NewCache(path string, maxSize int) *Cache {
+	cache := &Cache{
+		entries: map[string][]float64{},
+		maxSize: maxSize,
+		path:    path,
+	}
+	if maxSize < 0 || path == "" {
+		return cache
+	}
+
+	if err := cache.load(); err != nil {
+		logger.Warn(fmt.Sprintf(loadCacheErrorMessage, path, err.Error()))
+	}
+	return cache
+}
+
+func (cache *Cache) load() error {
+	file, err := os.Open(cache.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := 0
+	if file != nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			lines++
+			var record cacheRecord
+			if json.Unmarshal(scanner.Bytes(), &record) != nil || record.Key == "" {
+				continue
+			}
+			cache.add(record.Key, record.Embedding)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	// evicted and duplicated records are dropped by rewriting the file
+	if lines > len(cache.entries) {
+		if err := cache.compact(); err != nil {
+			return err
+		}
+	}
+
+	cache.file, err = os.OpenFile(cache.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+func (cache *Cache) compact() error {
+	tmpPath := cache.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, key := range cache.order {
+		data, _ := json.Marshal(cacheRecord{Key: key, Embedding: cache.entries[key]})
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	return os.Rename(tmpPath, cache.path)
+}
+
+func (cache *Cache) enabled() bool {
+	return cache != nil && cache.maxSize >= 0
+}
+
+// Key identifies an input element, which is either a string or a token array.
+func Key(model string, dimensions int, input interface{}) string {
+	data, _ := json.Marshal(input)
+	hash := sha256.New()
+	hash.Write([]byte(model))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strconv.Itoa(dimensions)))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (cache *Cache) Get(key string) ([]float64, bool) {
+	if !cache.enabled() {
+		return nil, false
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	embedding, ok := cache.entries[key]
+	if ok {
+		cache.hits++
+	} else {
+		cache.misses++
+	}
+	return embedding, ok
+}
+
+func (cache *Cache) Put(key string, embedding []float64) {
+	if !cache.enabled() || len(embedding) == 0 {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if _, ok := cache.entries[key]; ok {
+		return
+	}
+
+	cache.add(key, embedding)
+	cache.stores++
+	if cache.file != nil {
+		data, _ := json.Marshal(cacheRecord{Key: key, Embedding: embedding})
+		if _, err := cache.file.Write(append(data, '\n')); err != nil {
+			logger.Warn(fmt.Sprintf(writeCacheErrorMessage, cache.path, err.Error()))
+		}
+	}
+}
+
+func (cache *Cache) add(key string, embedding []float64) {
+	if _, ok := cache.entries[key]; !ok {
+		cache.order = append(cache.order, key)
+	}
+	cache.entries[key] = embedding
+
+	for cache.maxSize > 0 && len(cache.order) > cache.maxSize {
+		delete(cache.entries, cache.order[0])
+		cache.order = cache.order[1:]
+		cache.evictions++
+	}
+}
+
+// Clear drops every entry, including the persisted ones.
+func (cache *Cache) Clear() error {
+	if !cache.enabled() {
+		return nil
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.entries = map[string][]float64{}
+	cache.order = nil
+	if cache.file != nil {
+		return cache.file.Truncate(0)
+	}
+	return nil
+}
+
+func (cache *Cache) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	stats := CacheStats{
+		Enabled:   cache.enabled(),
+		Path:      cache.path,
+		Entries:   len(cache.entries),
+		MaxSize:   cache.maxSize,
+		Hits:      cache.hits,
+		Misses:    cache.misses,
+		Stores:    cache.stores,
+		Evictions: cache.evictions,
+	}
+	if lookups := cache.hits + cache.misses; lookups != 0 {
+		stats.HitRate = float64(cache.hits) / float64(lookups)
+	}
+	return stats
+}
+
+// Close flushes the persisted entries to disk, the cache keeps working in memory afterwards.
+func (cache *Cache) Close() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.file == nil {
+		return nil
+	}
+
+	err := cache.file.Sync()
+	if closeErr := cache.file.Close(); err == nil {
+		err = closeErr
+	}
+	cache.file = nil
+	return err
+}
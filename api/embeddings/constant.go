@@ -0,0 +1,8 @@
+package embeddings
+
+const (
+	defaultCacheSize = 100000
+
+	loadCacheErrorMessage  = "failed to load embedding cache %s: %s"
+	writeCacheErrorMessage = "failed to write embedding cache %s: %s"
+)
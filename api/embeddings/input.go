@@ -0,0 +1,61 @@
+package embeddings
+
+// SplitInput turns an embeddings input into its elements, an element is either a string or a token array.
+func SplitInput(input interface{}) ([]interface{}, bool) {
+	switch value := input.(type) {
+	case string:
+		return []interface{}{value}, true
+	case []interface{}:
+		if len(value) == 0 {
+			return nil, false
+		}
+		if _, ok := value[0].(float64); ok {
+			// a single token array
+			if !isTokens(value) {
+				return nil, false
+			}
+			return []interface{}{value}, true
+		}
+		for _, item := range value {
+			switch element := item.(type) {
+			case string:
+			case []interface{}:
+				if !isTokens(element) {
+					return nil, false
+				}
+			default:
+				return nil, false
+			}
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+func isTokens(tokens []interface{}) bool {
+	for _, token := range tokens {
+		if _, ok := token.(float64); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Vector converts a decoded json float array.
+func Vector(embedding interface{}) ([]float64, bool) {
+	switch value := embedding.(type) {
+	case []float64:
+		return value, true
+	case []interface{}:
+		vector := make([]float64, len(value))
+		for i, item := range value {
+			f, ok := item.(float64)
+			if !ok {
+				return nil, false
+			}
+			vector[i] = f
+		}
+		return vector, true
+	}
+	return nil, false
+}
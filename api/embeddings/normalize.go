@@ -0,0 +1,88 @@
+package embeddings
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+// Normalize applies encoding_format and dimensions to the data items of an openai embeddings response.
+// Vectors may arrive as floats or base64, they leave as floats unless base64 is requested.
+func Normalize(data []map[string]interface{}, encodingFormat string, dimensions int) {
+	for _, item := range data {
+		if item == nil {
+			continue
+		}
+
+		vector, ok := Vector(item["embedding"])
+		if !ok {
+			encoded, isString := item["embedding"].(string)
+			if !isString {
+				continue
+			}
+			if vector, ok = Decode(encoded); !ok {
+				continue
+			}
+		}
+
+		vector = Resize(vector, dimensions)
+		if encodingFormat == "base64" {
+			item["embedding"] = Encode(vector)
+		} else {
+			item["embedding"] = vector
+		}
+	}
+}
+
+// Resize shortens vector to dimensions and scales it back to unit length,
+// which is what the text-embedding-3 models do for the dimensions parameter.
+func Resize(vector []float64, dimensions int) []float64 {
+	if dimensions <= 0 || len(vector) <= dimensions {
+		return vector
+	}
+
+	resized := make([]float64, dimensions)
+	copy(resized, vector[:dimensions])
+	norm := 0.0
+	for _, value := range resized {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return resized
+	}
+	for i := range resized {
+		resized[i] /= norm
+	}
+	return resized
+}
+
+// Encode converts a vector into little endian float32 base64, like the openai api does.
+func Encode(vector []float64) string {
+	buf := new(bytes.Buffer)
+	for _, value := range vector {
+		binary.Write(buf, binary.LittleEndian, float32(value))
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func Decode(encoded string) ([]float64, bool) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data)%4 != 0 {
+		return nil, false
+	}
+
+	vector := make([]float64, len(data)/4)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+	}
+	return vector, true
+}
+
+// SupportsDimensions reports whether upstream can shorten vectors itself,
+// other models reject the parameter and are resized locally.
+func SupportsDimensions(model string) bool {
+	return strings.HasPrefix(model, "text-embedding-3")
+}
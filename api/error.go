@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// Error is the OpenAI error object, every endpoint reports failures as {"error": Error}.
+type Error struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    any     `json:"code"`
+}
+
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func NewError(statusCode int, message string) *Error {
+	return &Error{Message: message, Type: ErrorType(statusCode)}
+}
+
+func NewParamError(statusCode int, message string, param string) *Error {
+	e := NewError(statusCode, message)
+	e.Param = &param
+	return e
+}
+
+// ErrorType maps a status to the error type the OpenAI SDKs expect.
+func ErrorType(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return authenticationErrorType
+	case statusCode == http.StatusForbidden:
+		return permissionErrorType
+	case statusCode == http.StatusTooManyRequests:
+		return rateLimitErrorType
+	case statusCode >= http.StatusInternalServerError:
+		return serverErrorType
+	default:
+		return invalidRequestErrorType
+	}
+}
+
+// ErrorStatus is the inverse of ErrorType, used when only an error event is left of a failed stream.
+func ErrorStatus(errorType string) int {
+	switch errorType {
+	case invalidRequestErrorType:
+		return http.StatusBadRequest
+	case authenticationErrorType:
+		return http.StatusUnauthorized
+	case permissionErrorType:
+		return http.StatusForbidden
+	case rateLimitErrorType:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func AbortWithError(c *gin.Context, statusCode int, message string) {
+	Abort(c, statusCode, NewError(statusCode, message))
+}
+
+func AbortWithParamError(c *gin.Context, statusCode int, message string, param string) {
+	Abort(c, statusCode, NewParamError(statusCode, message, param))
+}
+
+// Abort writes err with statusCode, or as a terminal SSE event if the stream has already started.
+func Abort(c *gin.Context, statusCode int, err *Error) {
+	logger.Warn(err.Message)
+
+	if c.Writer.Written() {
+		if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+			WriteStreamError(c.Writer, err)
+		}
+		c.Abort()
+		return
+	}
+
+	c.AbortWithStatusJSON(statusCode, ErrorResponse{Error: err})
+}
+
+// WriteStreamError emits err as an SSE data event, the OpenAI SDKs raise it as an API error.
+func WriteStreamError(w gin.ResponseWriter, err *Error) {
+	data, _ := json.Marshal(ErrorResponse{Error: err})
+	w.Write([]byte("data: " + string(data) + "\n\n"))
+	w.Flush()
+}
+
+// ParseStreamError returns the error carried by an SSE data payload, if any.
+func ParseStreamError(data []byte) (*Error, bool) {
+	var response ErrorResponse
+	if err := json.Unmarshal(data, &response); err != nil || response.Error == nil || response.Error.Message == "" {
+		return nil, false
+	}
+	if response.Error.Type == "" {
+		response.Error.Type = serverErrorType
+	}
+	return response.Error, true
+}
+
+func AbortWithUpstreamError(c *gin.Context, statusCode int, body []byte) {
+	statusCode, err := ParseUpstreamError(statusCode, body)
+	Abort(c, statusCode, err)
+}
+
+func AbortWithUpstreamMap(c *gin.Context, statusCode int, responseMap map[string]interface{}) {
+	statusCode, err := UpstreamError(statusCode, responseMap)
+	Abort(c, statusCode, err)
+}
+
+func AbortWithUpstreamResponse(c *gin.Context, resp *http.Response) {
+	body, _ := io.ReadAll(resp.Body)
+	AbortWithUpstreamError(c, resp.StatusCode, body)
+}
+
+// ParseUpstreamError converts the error shapes of the upstreams (openai, chatgpt detail, patsnap msg/error_code ...)
+// into an OpenAI error. Upstreams sometimes fail with 200, which is reported as 502.
+func ParseUpstreamError(statusCode int, body []byte) (int, *Error) {
+	if statusCode < http.StatusBadRequest {
+		statusCode = http.StatusBadGateway
+	}
+
+	var responseMap map[string]interface{}
+	if err := json.Unmarshal(body, &responseMap); err != nil {
+		message := strings.TrimSpace(string(body))
+		if message == "" {
+			message = http.StatusText(statusCode)
+		}
+		return statusCode, NewError(statusCode, message)
+	}
+	return UpstreamError(statusCode, responseMap)
+}
+
+func UpstreamError(statusCode int, responseMap map[string]interface{}) (int, *Error) {
+	if statusCode < http.StatusBadRequest {
+		statusCode = http.StatusBadGateway
+	}
+
+	// patsnap reports the real status in error_code
+	if code, ok := responseMap["error_code"].(float64); ok && code >= http.StatusBadRequest && code < 600 {
+		statusCode = int(code)
+	}
+
+	e := NewError(statusCode, "")
+	if inner, ok := responseMap["error"].(map[string]interface{}); ok {
+		e.Message, _ = inner["message"].(string)
+		if errorType, ok := inner["type"].(string); ok && errorType != "" {
+			e.Type = errorType
+		}
+		if param, ok := inner["param"].(string); ok && param != "" {
+			e.Param = &param
+		}
+		e.Code = inner["code"]
+	}
+	if detail, ok := responseMap["detail"].(map[string]interface{}); ok {
+		// chatgpt sends {"detail": {"message": ..., "code": ...}}
+		if e.Message == "" {
+			e.Message, _ = detail["message"].(string)
+		}
+		if e.Code == nil {
+			e.Code = detail["code"]
+		}
+	}
+	for _, key := range []string{"error", defaultErrorMessageKey, "msg", "detail", "message"} {
+		if e.Message != "" {
+			break
+		}
+		e.Message, _ = responseMap[key].(string)
+	}
+	if e.Code == nil {
+		e.Code = responseMap["error_code"]
+	}
+
+	if e.Message == "" {
+		if data, err := json.Marshal(responseMap); err == nil && len(responseMap) != 0 {
+			e.Message = string(data)
+		} else {
+			e.Message = http.StatusText(statusCode)
+		}
+	}
+	if code, ok := e.Code.(float64); ok {
+		e.Code = fmt.Sprint(int(code))
+	}
+	return statusCode, e
+}
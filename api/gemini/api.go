@@ -0,0 +1,158 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// GenerateContent serves both models/{model}:generateContent and models/{model}:streamGenerateContent.
+func GenerateContent(c *gin.Context) {
+	model, action, _ := strings.Cut(strings.TrimPrefix(c.Param("model"), "/"), ":")
+	if action != actionGenerateContent && action != actionStreamGenerateContent {
+		abortWithError(c, http.StatusNotFound, fmt.Sprintf(unsupportedActionMessage, action))
+		return
+	}
+
+	var request GenerateContentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	if len(request.Contents) == 0 {
+		abortWithError(c, http.StatusBadRequest, emptyContentsErrorMessage)
+		return
+	}
+
+	chatRequest := convertRequest(model, request)
+	if action == actionGenerateContent {
+		completion, err := backend.Complete(c, chatRequest)
+		if err != nil {
+			abortWithBackendError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, convertCompletion(completion))
+		return
+	}
+
+	streamGenerateContent(c, chatRequest, c.Query("alt") == "sse")
+}
+
+func streamGenerateContent(c *gin.Context, chatRequest backend.ChatCompletionRequest, sse bool) {
+	chatRequest.StreamOptions = &backend.StreamOptions{IncludeUsage: true}
+
+	// backend.Stream swaps c.Writer while the backend runs, keep the client writer
+	w := c.Writer
+	started := false
+	var toolCalls []backend.ToolCall
+	write := func(response any) {
+		data, _ := json.Marshal(response)
+		if !started {
+			started = true
+			if sse {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte("["))
+			}
+		} else if !sse {
+			w.Write([]byte(",\r\n"))
+		}
+
+		if sse {
+			w.Write([]byte("data: " + string(data) + "\r\n\r\n"))
+		} else {
+			w.Write(data)
+		}
+		w.Flush()
+	}
+
+	err := backend.Stream(c, chatRequest, func(chunk backend.ChatCompletion) {
+		response := GenerateContentResponse{ModelVersion: chunk.Model, UsageMetadata: convertUsage(chunk.Usage)}
+		for _, choice := range chunk.Choices {
+			candidate := Candidate{Index: choice.Index, Content: Content{Role: roleModel, Parts: []Part{}}}
+			if choice.Delta != nil {
+				if text := choice.Delta.Text(); text != "" {
+					candidate.Content.Parts = append(candidate.Content.Parts, Part{Text: text})
+				}
+				toolCalls = backend.MergeToolCalls(toolCalls, choice.Delta.ToolCalls)
+			}
+			if choice.FinishReason != "" {
+				// gemini sends function calls as a whole, so they are released with the finish reason
+				candidate.Content.Parts = append(candidate.Content.Parts, convertToolCalls(toolCalls)...)
+				toolCalls = nil
+				candidate.FinishReason = convertFinishReason(choice.FinishReason)
+			}
+			if len(candidate.Content.Parts) != 0 || candidate.FinishReason != "" {
+				response.Candidates = append(response.Candidates, candidate)
+			}
+		}
+		if len(response.Candidates) != 0 || response.UsageMetadata != nil {
+			write(response)
+		}
+	})
+	if err != nil {
+		if !started {
+			abortWithBackendError(c, err)
+			return
+		}
+		// the stream has started, the error is its final element
+		statusCode, e := backend.ToError(err)
+		logger.Warn(e.Message)
+		write(newErrorResponse(statusCode, e.Message))
+	}
+
+	if started && !sse {
+		w.Write([]byte("]"))
+		w.Flush()
+	}
+}
+
+// gemini clients expect google's error shape instead of the openai one
+func abortWithBackendError(c *gin.Context, err error) {
+	statusCode, e := backend.ToError(err)
+	abortWithError(c, statusCode, e.Message)
+}
+
+func abortWithError(c *gin.Context, statusCode int, message string) {
+	logger.Warn(message)
+
+	c.AbortWithStatusJSON(statusCode, newErrorResponse(statusCode, message))
+}
+
+func newErrorResponse(statusCode int, message string) gin.H {
+	return gin.H{
+		"error": gin.H{
+			"code":    statusCode,
+			"message": message,
+			"status":  errorStatus(statusCode),
+		},
+	}
+}
+
+func errorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	}
+	return "INTERNAL"
+}
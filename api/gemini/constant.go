@@ -0,0 +1,12 @@
+package gemini
+
+const (
+	roleModel = "model"
+
+	actionGenerateContent       = "generateContent"
+	actionStreamGenerateContent = "streamGenerateContent"
+
+	parseJsonErrorMessage     = "failed to parse json request body"
+	unsupportedActionMessage  = "unsupported action: %s"
+	emptyContentsErrorMessage = "contents must not be empty"
+)
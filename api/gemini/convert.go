@@ -0,0 +1,243 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+)
+
+func convertRequest(model string, request GenerateContentRequest) backend.ChatCompletionRequest {
+	chatRequest := backend.ChatCompletionRequest{
+		Model: model,
+	}
+
+	if request.SystemInstruction != nil {
+		if text := joinText(request.SystemInstruction.Parts); text != "" {
+			chatRequest.Messages = append(chatRequest.Messages, backend.ChatMessage{Role: "system", Content: text})
+		}
+	}
+
+	// gemini matches function responses by name, openai by id
+	pendingCallIDs := map[string][]string{}
+	callCount := 0
+	for _, content := range request.Contents {
+		if content.Role == roleModel {
+			message := backend.ChatMessage{Role: "assistant", Content: joinText(content.Parts)}
+			for _, part := range content.Parts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				callCount++
+				id := fmt.Sprintf("call_%d_%s", callCount, part.FunctionCall.Name)
+				pendingCallIDs[part.FunctionCall.Name] = append(pendingCallIDs[part.FunctionCall.Name], id)
+				arguments, _ := json.Marshal(part.FunctionCall.Args)
+				message.ToolCalls = append(message.ToolCalls, backend.ToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: backend.FunctionCall{Name: part.FunctionCall.Name, Arguments: string(arguments)},
+				})
+			}
+			if len(message.ToolCalls) != 0 && message.Content == "" {
+				message.Content = nil
+			}
+			chatRequest.Messages = append(chatRequest.Messages, message)
+			continue
+		}
+
+		var parts []backend.ContentPart
+		hasImage := false
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := ""
+				if ids := pendingCallIDs[name]; len(ids) != 0 {
+					id = ids[0]
+					pendingCallIDs[name] = ids[1:]
+				} else {
+					callCount++
+					id = fmt.Sprintf("call_%d_%s", callCount, name)
+				}
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				chatRequest.Messages = append(chatRequest.Messages, backend.ChatMessage{
+					Role:       "tool",
+					Name:       name,
+					Content:    string(response),
+					ToolCallID: id,
+				})
+			case part.InlineData != nil:
+				hasImage = true
+				parts = append(parts, backend.ContentPart{
+					Type:     "image_url",
+					ImageURL: &backend.ImageURL{URL: "data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data},
+				})
+			case part.FileData != nil:
+				hasImage = true
+				parts = append(parts, backend.ContentPart{
+					Type:     "image_url",
+					ImageURL: &backend.ImageURL{URL: part.FileData.FileUri},
+				})
+			case part.Text != "":
+				parts = append(parts, backend.ContentPart{Type: "text", Text: part.Text})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		if hasImage {
+			chatRequest.Messages = append(chatRequest.Messages, backend.ChatMessage{Role: "user", Content: parts})
+		} else {
+			chatRequest.Messages = append(chatRequest.Messages, backend.ChatMessage{Role: "user", Content: joinText(content.Parts)})
+		}
+	}
+
+	for _, tool := range request.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			chatRequest.Tools = append(chatRequest.Tools, backend.Tool{
+				Type: "function",
+				Function: backend.FunctionDefinition{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  lowerSchemaTypes(declaration.Parameters),
+				},
+			})
+		}
+	}
+
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil && len(chatRequest.Tools) != 0 {
+		config := request.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(config.Mode) {
+		case "NONE":
+			chatRequest.ToolChoice = "none"
+		case "ANY":
+			if len(config.AllowedFunctionNames) == 1 {
+				chatRequest.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": config.AllowedFunctionNames[0]},
+				}
+			} else {
+				chatRequest.ToolChoice = "required"
+			}
+		case "AUTO":
+			chatRequest.ToolChoice = "auto"
+		}
+	}
+
+	if config := request.GenerationConfig; config != nil {
+		chatRequest.Temperature = config.Temperature
+		chatRequest.TopP = config.TopP
+		chatRequest.MaxTokens = config.MaxOutputTokens
+		chatRequest.Stop = config.StopSequences
+		chatRequest.N = config.CandidateCount
+		chatRequest.PresencePenalty = config.PresencePenalty
+		chatRequest.FrequencyPenalty = config.FrequencyPenalty
+		chatRequest.Seed = config.Seed
+		if config.ResponseMimeType == "application/json" {
+			if config.ResponseSchema != nil {
+				chatRequest.ResponseFormat = map[string]any{
+					"type": "json_schema",
+					"json_schema": map[string]any{
+						"name":   "response",
+						"schema": lowerSchemaTypes(config.ResponseSchema),
+					},
+				}
+			} else {
+				chatRequest.ResponseFormat = map[string]any{"type": "json_object"}
+			}
+		}
+	}
+
+	return chatRequest
+}
+
+func convertCompletion(completion *backend.ChatCompletion) GenerateContentResponse {
+	response := GenerateContentResponse{ModelVersion: completion.Model}
+	for _, choice := range completion.Choices {
+		candidate := Candidate{
+			Index:        choice.Index,
+			FinishReason: convertFinishReason(choice.FinishReason),
+			Content:      Content{Role: roleModel, Parts: []Part{}},
+		}
+		if choice.Message != nil {
+			if text := choice.Message.Text(); text != "" {
+				candidate.Content.Parts = append(candidate.Content.Parts, Part{Text: text})
+			}
+			candidate.Content.Parts = append(candidate.Content.Parts, convertToolCalls(choice.Message.ToolCalls)...)
+		}
+		response.Candidates = append(response.Candidates, candidate)
+	}
+	response.UsageMetadata = convertUsage(completion.Usage)
+	return response
+}
+
+func convertToolCalls(toolCalls []backend.ToolCall) []Part {
+	var parts []Part
+	for _, toolCall := range toolCalls {
+		args := map[string]any{}
+		json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
+		parts = append(parts, Part{FunctionCall: &FunctionCall{Name: toolCall.Function.Name, Args: args}})
+	}
+	return parts
+}
+
+func convertUsage(usage *backend.Usage) *UsageMetadata {
+	if usage == nil {
+		return nil
+	}
+
+	return &UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.TotalTokens,
+	}
+}
+
+func convertFinishReason(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func joinText(parts []Part) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// gemini schemas use upper case types like OBJECT and STRING, json schema wants them lower case
+func lowerSchemaTypes(schema any) any {
+	switch value := schema.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(value))
+		for key, item := range value {
+			if key == "type" {
+				if s, ok := item.(string); ok {
+					converted[key] = strings.ToLower(s)
+					continue
+				}
+			}
+			converted[key] = lowerSchemaTypes(item)
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(value))
+		for i, item := range value {
+			converted[i] = lowerSchemaTypes(item)
+		}
+		return converted
+	}
+	return schema
+}
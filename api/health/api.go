@@ -0,0 +1,27 @@
+package health
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz only tells the process is alive, it never calls an upstream.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": statusOk,
+	})
+}
+
+// Readyz reports the cached probe results, 503 until every probe has passed.
+func Readyz(c *gin.Context) {
+	results, ready := Results()
+
+	status, statusCode := statusOk, http.StatusOK
+	if !ready {
+		status, statusCode = statusFailed, http.StatusServiceUnavailable
+	}
+	c.JSON(statusCode, gin.H{
+		"status":    status,
+		"providers": results,
+	})
+}
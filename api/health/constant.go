@@ -0,0 +1,16 @@
+package health
+
+import "time"
+
+const (
+	defaultInterval = time.Minute
+	defaultTimeout  = 10 * time.Second
+
+	statusOk      = "ok"
+	statusFailed  = "failed"
+	statusPending = "pending"
+
+	probeFailedMessage      = "%s probe failed: %s"
+	probeTimeoutMessage     = "probe timed out after %s"
+	unexpectedStatusMessage = "unexpected status %s"
+)
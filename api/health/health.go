@@ -0,0 +1,175 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/linweiyuan/go-logger/logger"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+// Probe checks that an upstream is reachable, a nil error means ready. ctx ends after HEALTH_CHECK_TIMEOUT.
+type Probe func(ctx context.Context) error
+
+type Result struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Latency   string     `json:"latency,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+var (
+	probes  = map[string]Probe{}
+	results = map[string]Result{}
+	mu      sync.RWMutex
+	once    sync.Once
+	stop    = make(chan struct{})
+	stopped sync.Once
+)
+
+// Register adds a probe, it runs with every other probe once Start is called.
+func Register(name string, probe Probe) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	probes[name] = probe
+	results[name] = Result{Status: statusPending}
+}
+
+// Start runs the probes in the background every HEALTH_CHECK_INTERVAL, it never blocks.
+func Start() {
+	once.Do(func() {
+		go loop(durationEnv("HEALTH_CHECK_INTERVAL", defaultInterval), durationEnv("HEALTH_CHECK_TIMEOUT", defaultTimeout))
+	})
+}
+
+// Stop ends the background probes, the last results are kept.
+func Stop() {
+	stopped.Do(func() {
+		close(stop)
+	})
+}
+
+// Results returns the last result of every probe and whether all of them passed.
+func Results() (map[string]Result, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	ready := true
+	snapshot := make(map[string]Result, len(results))
+	for name, result := range results {
+		snapshot[name] = result
+		if result.Status != statusOk {
+			ready = false
+		}
+	}
+	return snapshot, ready
+}
+
+func loop(interval time.Duration, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runAll(timeout)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runAll(timeout time.Duration) {
+	mu.RLock()
+	names := make([]string, 0, len(probes))
+	for name := range probes {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			run(name, timeout)
+		}(name)
+	}
+	wg.Wait()
+}
+
+func run(name string, timeout time.Duration) {
+	mu.RLock()
+	probe := probes[name]
+	mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- probe(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf(probeTimeoutMessage, timeout)
+	}
+
+	now := time.Now()
+	result := Result{
+		Status:    statusOk,
+		Latency:   now.Sub(start).Round(time.Millisecond).String(),
+		CheckedAt: &now,
+	}
+	if err != nil {
+		result.Status = statusFailed
+		result.Error = err.Error()
+	}
+
+	mu.Lock()
+	previous := results[name]
+	results[name] = result
+	mu.Unlock()
+
+	if err != nil && previous.Error != result.Error {
+		logger.Warn(fmt.Sprintf(probeFailedMessage, name, err.Error()))
+	}
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// ExpectStatus probes with an unauthenticated GET through the client of provider, upstreams that are up answer with the expected status.
+func ExpectStatus(provider string, url string, statusCode int) Probe {
+	return func(ctx context.Context) error {
+		req, _ := api.NewUpstreamRequest(ctx, provider, http.MethodGet, url, nil)
+		req.Header.Set("User-Agent", api.UserAgent)
+		resp, err := api.GetClient(provider).Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != statusCode {
+			return fmt.Errorf(unexpectedStatusMessage, resp.Status)
+		}
+		return nil
+	}
+}
@@ -3,6 +3,7 @@ package imitate
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -32,90 +33,49 @@ func CreateChatCompletions(c *gin.Context) {
 	var originalRequest APIRequest
 	err := c.BindJSON(&originalRequest)
 	if err != nil {
-		c.JSON(400, gin.H{"error": gin.H{
-			"message": "Request must be proper JSON",
-			"type":    "invalid_request_error",
-			"param":   nil,
-			"code":    err.Error(),
-		}})
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
 		return
 	}
 
-	authHeader := c.GetHeader(api.AuthorizationHeader)
-	token := os.Getenv("IMITATE_ACCESS_TOKEN")
-	if authHeader != "" {
-		customAccessToken := strings.Replace(authHeader, "Bearer ", "", 1)
-		// Check if customAccessToken starts with sk-
-		if strings.HasPrefix(customAccessToken, "eyJhbGciOiJSUzI1NiI") {
-			token = customAccessToken
-		}
-	}
+	token := getAccessToken(c)
 
 	// 将聊天请求转换为ChatGPT请求。
-	translatedRequest, model := convertAPIRequest(originalRequest)
-
-	response, done := sendConversationRequest(c, translatedRequest, token)
-	if done {
-		return
-	}
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			return
-		}
-	}(response.Body)
-
-	if HandleRequestError(c, response) {
-		return
-	}
-
-	var fullResponse string
+	translatedRequest, model := convertAPIRequest(c.Request.Context(), originalRequest)
 
 	id := generateId()
+	state := &StreamState{}
+	maxContinuations := chatgpt.MaxContinuations(originalRequest.MaxContinuations, os.Getenv("CONTINUE_SIGNAL") != "")
 
-	for i := 3; i > 0; i-- {
-		var continueInfo *ContinueInfo
-		var responsePart string
-		var continueSignal string
-		responsePart, continueInfo = Handler(c, response, originalRequest.Stream, id, model)
-		fullResponse += responsePart
-		continueSignal = os.Getenv("CONTINUE_SIGNAL")
-		if continueInfo == nil || continueSignal == "" {
-			break
-		}
-		println("Continuing conversation")
-		translatedRequest.Messages = nil
-		translatedRequest.Action = "continue"
-		translatedRequest.ConversationID = &continueInfo.ConversationID
-		translatedRequest.ParentMessageID = continueInfo.ParentID
-		response, done = sendConversationRequest(c, translatedRequest, token)
-
-		if done {
-			return
-		}
-
-		// 以下修复代码来自ChatGPT
-		// 在循环内部创建一个局部作用域，并将资源的引用传递给匿名函数，保证资源将在每次迭代结束时被正确释放
-		func() {
-			defer func(Body io.ReadCloser) {
-				err := Body.Close()
-				if err != nil {
-					return
-				}
-			}(response.Body)
-		}()
-
-		if HandleRequestError(c, response) {
-			return
-		}
+	send := func(c *gin.Context, request chatgpt.CreateConversationRequest) (*http.Response, bool) {
+		state.NextTurn()
+		return sendConversationRequest(c, request, token)
+	}
+	handle := func(response *http.Response, canContinue bool) (*chatgpt.ContinueInfo, bool) {
+		continueInfo := Handler(c, response, originalRequest.Stream, id, model, state, canContinue)
+		return continueInfo, !c.IsAborted()
+	}
+	if !chatgpt.Continue(c, translatedRequest, maxContinuations, send, handle) {
+		return
 	}
 
 	if !originalRequest.Stream {
-		c.JSON(200, newChatCompletion(fullResponse, model, id))
+		c.JSON(200, newChatCompletion(state.Text, model, id))
 	} else {
-		c.String(200, "data: [DONE]\n\n")
+		writeStream(c, "data: [DONE]\n\n")
+	}
+}
+
+// writeStream sends an SSE chunk, the stream header goes out with the first one so that
+// errors before it are still answered as plain JSON.
+func writeStream(c *gin.Context, data string) error {
+	if !c.Writer.Written() {
+		c.Header("Content-Type", "text/event-stream")
+	}
+	if _, err := c.Writer.WriteString(data); err != nil {
+		return err
 	}
+	c.Writer.Flush()
+	return nil
 }
 
 func generateId() string {
@@ -126,7 +86,20 @@ func generateId() string {
 	return "chatcmpl-" + id
 }
 
-func convertAPIRequest(apiRequest APIRequest) (chatgpt.CreateConversationRequest, string) {
+func getAccessToken(c *gin.Context) string {
+	authHeader := c.GetHeader(api.AuthorizationHeader)
+	token := os.Getenv("IMITATE_ACCESS_TOKEN")
+	if authHeader != "" {
+		customAccessToken := strings.Replace(authHeader, "Bearer ", "", 1)
+		// Check if customAccessToken starts with sk-
+		if strings.HasPrefix(customAccessToken, "eyJhbGciOiJSUzI1NiI") {
+			token = customAccessToken
+		}
+	}
+	return token
+}
+
+func convertAPIRequest(ctx context.Context, apiRequest APIRequest) (chatgpt.CreateConversationRequest, string) {
 	chatgptRequest := NewChatGPTRequest()
 
 	var model = "gpt-3.5-turbo-0613"
@@ -136,7 +109,7 @@ func convertAPIRequest(apiRequest APIRequest) (chatgpt.CreateConversationRequest
 	}
 
 	if strings.HasPrefix(apiRequest.Model, "gpt-4") {
-		arkoseToken, err := api.GetArkoseToken()
+		arkoseToken, err := api.GetArkoseToken(ctx)
 		if err == nil {
 			chatgptRequest.ArkoseToken = arkoseToken
 		} else {
@@ -173,16 +146,16 @@ func NewChatGPTRequest() chatgpt.CreateConversationRequest {
 
 func sendConversationRequest(c *gin.Context, request chatgpt.CreateConversationRequest, accessToken string) (*http.Response, bool) {
 	jsonBytes, _ := json.Marshal(request)
-	req, _ := http.NewRequest(http.MethodPost, api.ChatGPTApiUrlPrefix+"/backend-api/conversation", bytes.NewBuffer(jsonBytes))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, http.MethodPost, api.ChatGPTApiUrlPrefix+"/backend-api/conversation", bytes.NewBuffer(jsonBytes))
 	req.Header.Set("User-Agent", api.UserAgent)
 	req.Header.Set(api.AuthorizationHeader, accessToken)
 	req.Header.Set("Accept", "text/event-stream")
-	if api.PUID != "" {
-		req.Header.Set("Cookie", "_puid="+api.PUID)
+	if puid := api.GetPUID(); puid != "" {
+		req.Header.Set("Cookie", "_puid="+puid)
 	}
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderChatGPT).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return nil, true
 	}
 
@@ -191,40 +164,31 @@ func sendConversationRequest(c *gin.Context, request chatgpt.CreateConversationR
 			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
 		}
 
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 		return nil, true
 	}
 
 	return resp, false
 }
 
-func Handler(c *gin.Context, response *http.Response, stream bool, id string, model string) (string, *ContinueInfo) {
+// Handler relays one upstream answer. A truncated answer that is going to be continued keeps its
+// stop chunk back, so that the stitched stream ends with exactly one.
+func Handler(c *gin.Context, response *http.Response, stream bool, id string, model string, state *StreamState, canContinue bool) *chatgpt.ContinueInfo {
 	maxTokens := false
 
 	// Create a bufio.Reader from the response body
 	reader := bufio.NewReader(response.Body)
 
-	// Read the response byte by byte until a newline character is encountered
-	if stream {
-		// Response content type is text/event-stream
-		c.Header("Content-Type", "text/event-stream")
-	} else {
-		// Response content type is application/json
-		c.Header("Content-Type", "application/json")
-	}
 	var finishReason string
-	var previousText StringStruct
 	var originalResponse ChatGPTResponse
-	var isRole = true
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return "", nil
+			api.AbortWithError(c, http.StatusBadGateway, err.Error())
+			return nil
 		}
 		if len(line) < 6 {
 			continue
@@ -240,8 +204,8 @@ func Handler(c *gin.Context, response *http.Response, stream bool, id string, mo
 				continue
 			}
 			if originalResponse.Error != nil {
-				c.JSON(500, gin.H{"error": originalResponse.Error})
-				return "", nil
+				api.AbortWithUpstreamMap(c, http.StatusBadGateway, map[string]interface{}{"error": originalResponse.Error})
+				return nil
 			}
 			if originalResponse.Message.Author.Role != "assistant" || originalResponse.Message.Content.Parts == nil {
 				continue
@@ -249,19 +213,15 @@ func Handler(c *gin.Context, response *http.Response, stream bool, id string, mo
 			if originalResponse.Message.Metadata.MessageType != "next" && originalResponse.Message.Metadata.MessageType != "continue" || originalResponse.Message.EndTurn != nil {
 				continue
 			}
-			if (len(originalResponse.Message.Content.Parts) == 0 || originalResponse.Message.Content.Parts[0] == "") && !isRole {
+			if (len(originalResponse.Message.Content.Parts) == 0 || originalResponse.Message.Content.Parts[0] == "") && state.RoleSent {
 				continue
 			}
-			responseString := ConvertToString(&originalResponse, &previousText, isRole, id, model)
-			isRole = false
-			if stream {
-				_, err = c.Writer.WriteString(responseString)
-				if err != nil {
-					return "", nil
+			responseString := ConvertToString(&originalResponse, state, id, model)
+			if stream && responseString != "" {
+				if writeStream(c, responseString) != nil {
+					return nil
 				}
 			}
-			// Flush the response writer buffer to ensure that the client receives each line as it's written
-			c.Writer.Flush()
 
 			if originalResponse.Message.Metadata.FinishDetails != nil {
 				if originalResponse.Message.Metadata.FinishDetails.Type == "max_tokens" {
@@ -271,23 +231,30 @@ func Handler(c *gin.Context, response *http.Response, stream bool, id string, mo
 			}
 
 		} else {
-			if stream {
-				if finishReason == "" {
-					finishReason = "stop"
-				}
-				finalLine := StopChunk(finishReason, id, model)
-				_, err := c.Writer.WriteString("data: " + finalLine.String() + "\n\n")
-				if err != nil {
-					return "", nil
+			if stream && !(maxTokens && canContinue) {
+				finalLine := StopChunk(toFinishReason(finishReason), id, model)
+				if writeStream(c, "data: "+finalLine.String()+"\n\n") != nil {
+					return nil
 				}
 			}
 		}
 	}
 	if !maxTokens {
-		return previousText.Text, nil
+		return nil
 	}
-	return previousText.Text, &ContinueInfo{
+	return &chatgpt.ContinueInfo{
 		ConversationID: originalResponse.ConversationID,
 		ParentID:       originalResponse.Message.ID,
 	}
 }
+
+func toFinishReason(finishType string) string {
+	switch finishType {
+	case "":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	default:
+		return finishType
+	}
+}
@@ -0,0 +1,17 @@
+package imitate
+
+const (
+	parseJsonErrorMessage = "failed to parse json request body"
+
+	defaultImageModel         = "gpt-4o"
+	maxImages                 = 4
+	imageResponseFormatURL    = "url"
+	imageResponseFormatB64    = "b64_json"
+	imageAssetPointerType     = "image_asset_pointer"
+	imageAssetPointerPrefix   = "file-service://"
+	missingPromptErrorMessage = "missing required parameter: 'prompt'"
+	invalidImageCountMessage  = "invalid 'n': expected a value between 1 and %d, got %d"
+	invalidImageFormatMessage = "invalid value for 'response_format': expected one of url, b64_json"
+	noImageGeneratedMessage   = "no image was generated for this prompt"
+	downloadImageErrorMessage = "failed to download generated image: %s"
+)
@@ -5,13 +5,12 @@ import (
 	"strings"
 )
 
-func ConvertToString(chatgptResponse *ChatGPTResponse, previousText *StringStruct, role bool, id string, model string) string {
+func ConvertToString(chatgptResponse *ChatGPTResponse, state *StreamState, id string, model string) string {
 	var text string
 
 	if len(chatgptResponse.Message.Content.Parts) == 1 {
 		if part, ok := chatgptResponse.Message.Content.Parts[0].(string); ok {
-			text = strings.ReplaceAll(part, previousText.Text, "")
-			previousText.Text = part
+			text = state.Delta(part)
 		} else {
 			text = fmt.Sprintf("%v", chatgptResponse.Message.Content.Parts[0])
 		}
@@ -27,9 +26,14 @@ func ConvertToString(chatgptResponse *ChatGPTResponse, previousText *StringStruc
 		text = strings.Join(parts, ", ")
 	}
 
+	if text == "" && state.RoleSent {
+		return ""
+	}
+
 	translatedResponse := NewChatCompletionChunk(text, id, model)
-	if role {
+	if !state.RoleSent {
 		translatedResponse.Choices[0].Delta.Role = chatgptResponse.Message.Author.Role
+		state.RoleSent = true
 	}
 
 	return "data: " + translatedResponse.String() + "\n\n"
@@ -0,0 +1,245 @@
+package imitate
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/chatgpt"
+)
+
+// CreateImages asks an image-capable ChatGPT model to draw the prompt and returns the generated files
+// in the OpenAI images API shape.
+func CreateImages(c *gin.Context) {
+	var request ImagesRequest
+	if err := c.BindJSON(&request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	if strings.TrimSpace(request.Prompt) == "" {
+		api.AbortWithParamError(c, http.StatusBadRequest, missingPromptErrorMessage, "prompt")
+		return
+	}
+
+	n := 1
+	if request.N != nil {
+		n = *request.N
+	}
+	if n < 1 || n > maxImages {
+		api.AbortWithParamError(c, http.StatusBadRequest, fmt.Sprintf(invalidImageCountMessage, maxImages, n), "n")
+		return
+	}
+
+	if request.ResponseFormat == "" {
+		request.ResponseFormat = imageResponseFormatURL
+	}
+	if request.ResponseFormat != imageResponseFormatURL && request.ResponseFormat != imageResponseFormatB64 {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidImageFormatMessage, "response_format")
+		return
+	}
+
+	token := getAccessToken(c)
+
+	var assets []imageAsset
+	for len(assets) < n {
+		generated, ok := generateImages(c, request, token)
+		if !ok {
+			return
+		}
+		if len(generated) == 0 {
+			break
+		}
+		assets = append(assets, generated...)
+	}
+	if len(assets) == 0 {
+		api.AbortWithError(c, http.StatusBadGateway, noImageGeneratedMessage)
+		return
+	}
+	if len(assets) > n {
+		assets = assets[:n]
+	}
+
+	response := ImagesResponse{
+		Created: time.Now().Unix(),
+		Data:    make([]Image, 0, len(assets)),
+	}
+	for _, asset := range assets {
+		downloadURL, ok := getDownloadURL(c, asset.fileID, token)
+		if !ok {
+			return
+		}
+
+		image := Image{RevisedPrompt: asset.revisedPrompt}
+		if request.ResponseFormat == imageResponseFormatB64 {
+			data, ok := downloadImage(c, downloadURL)
+			if !ok {
+				return
+			}
+			image.B64JSON = base64.StdEncoding.EncodeToString(data)
+		} else {
+			image.URL = downloadURL
+		}
+		response.Data = append(response.Data, image)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func newImagesConversationRequest(ctx context.Context, request ImagesRequest) chatgpt.CreateConversationRequest {
+	chatgptRequest := NewChatGPTRequest()
+
+	chatgptRequest.Model = request.Model
+	if chatgptRequest.Model == "" {
+		chatgptRequest.Model = os.Getenv("IMITATE_IMAGE_MODEL")
+	}
+	if chatgptRequest.Model == "" {
+		chatgptRequest.Model = defaultImageModel
+	}
+
+	if arkoseToken, err := api.GetArkoseToken(ctx); err == nil {
+		chatgptRequest.ArkoseToken = arkoseToken
+	}
+
+	prompt := request.Prompt
+	if request.Size != "" {
+		prompt += "\n\nImage size: " + request.Size
+	}
+	chatgptRequest.AddMessage("user", prompt)
+
+	return chatgptRequest
+}
+
+// generateImages runs one conversation and collects the image asset pointers from its SSE stream.
+func generateImages(c *gin.Context, request ImagesRequest, token string) ([]imageAsset, bool) {
+	response, done := sendConversationRequest(c, newImagesConversationRequest(c.Request.Context(), request), token)
+	if done {
+		return nil, false
+	}
+	defer response.Body.Close()
+
+	var assets []imageAsset
+	seen := map[string]bool{}
+	reader := bufio.NewReader(response.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			api.AbortWithError(c, http.StatusBadGateway, err.Error())
+			return nil, false
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+
+		var chatgptResponse ChatGPTResponse
+		if err := json.Unmarshal([]byte(data), &chatgptResponse); err != nil {
+			continue
+		}
+		if chatgptResponse.Error != nil {
+			api.AbortWithUpstreamMap(c, http.StatusBadGateway, map[string]interface{}{"error": chatgptResponse.Error})
+			return nil, false
+		}
+
+		for _, part := range chatgptResponse.Message.Content.Parts {
+			asset, ok := parseImageAsset(part)
+			if !ok || seen[asset.fileID] {
+				continue
+			}
+			seen[asset.fileID] = true
+			assets = append(assets, asset)
+		}
+	}
+
+	return assets, true
+}
+
+func parseImageAsset(part interface{}) (imageAsset, bool) {
+	partMap, ok := part.(map[string]interface{})
+	if !ok || partMap["content_type"] != imageAssetPointerType {
+		return imageAsset{}, false
+	}
+
+	pointer, _ := partMap["asset_pointer"].(string)
+	fileID, ok := strings.CutPrefix(pointer, imageAssetPointerPrefix)
+	if !ok || fileID == "" {
+		return imageAsset{}, false
+	}
+
+	asset := imageAsset{fileID: fileID}
+	if metadata, ok := partMap["metadata"].(map[string]interface{}); ok {
+		if dalle, ok := metadata["dalle"].(map[string]interface{}); ok {
+			asset.revisedPrompt, _ = dalle["prompt"].(string)
+		}
+	}
+	return asset, true
+}
+
+func getDownloadURL(c *gin.Context, fileID string, token string) (string, bool) {
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, http.MethodGet, api.ChatGPTApiUrlPrefix+"/backend-api/files/"+fileID+"/download", nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	req.Header.Set(api.AuthorizationHeader, token)
+	if puid := api.GetPUID(); puid != "" {
+		req.Header.Set("Cookie", "_puid="+puid)
+	}
+	resp, err := api.GetClient(api.ProviderChatGPT).Do(req)
+	if err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, api.UpstreamCause(req, err).Error())
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		api.AbortWithUpstreamResponse(c, resp)
+		return "", false
+	}
+
+	var download fileDownloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&download); err != nil || download.DownloadURL == "" {
+		message := download.ErrorCode
+		if err != nil {
+			message = err.Error()
+		}
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(downloadImageErrorMessage, message))
+		return "", false
+	}
+
+	return download.DownloadURL, true
+}
+
+func downloadImage(c *gin.Context, downloadURL string) ([]byte, bool) {
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderChatGPT, http.MethodGet, downloadURL, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := api.GetClient(api.ProviderChatGPT).Do(req)
+	if err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(downloadImageErrorMessage, api.UpstreamCause(req, err).Error()))
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(downloadImageErrorMessage, resp.Status))
+		return nil, false
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, fmt.Sprintf(downloadImageErrorMessage, err.Error()))
+		return nil, false
+	}
+	return data, true
+}
@@ -2,6 +2,7 @@ package imitate
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/dhso/go-chatgpt-api/api/chatgpt"
@@ -118,8 +119,32 @@ type FinishDetails struct {
 	Stop string `json:"stop"`
 }
 
-type StringStruct struct {
-	Text string `json:"text"`
+// StreamState is what has been relayed to the client across continuation turns.
+type StreamState struct {
+	Text     string
+	RoleSent bool
+
+	turnText string
+}
+
+// NextTurn marks the start of a continuation turn.
+func (s *StreamState) NextTurn() {
+	s.turnText = s.Text
+}
+
+// Delta returns the text that was not relayed yet. Continuation turns may either repeat the answer
+// so far or only carry the new text, both are stitched onto the answer.
+func (s *StreamState) Delta(part string) string {
+	text := part
+	if !strings.HasPrefix(part, s.turnText) {
+		text = s.turnText + part
+	}
+
+	delta := strings.TrimPrefix(text, s.Text)
+	if len(text) > len(s.Text) {
+		s.Text = text
+	}
+	return delta
 }
 
 func newChatCompletion(fullTest, model string, id string) ChatCompletion {
@@ -144,3 +169,25 @@ func newChatCompletion(fullTest, model string, id string) ChatCompletion {
 		},
 	}
 }
+
+type ImagesResponse struct {
+	Created int64   `json:"created"`
+	Data    []Image `json:"data"`
+}
+
+type Image struct {
+	URL           string `json:"url,omitempty"`
+	B64JSON       string `json:"b64_json,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+type imageAsset struct {
+	fileID        string
+	revisedPrompt string
+}
+
+type fileDownloadResponse struct {
+	Status      string `json:"status"`
+	DownloadURL string `json:"download_url"`
+	ErrorCode   string `json:"error_code"`
+}
@@ -0,0 +1,22 @@
+package jwt
+
+import "time"
+
+const (
+	IdentityKey = "identity"
+
+	defaultClockSkew     = time.Minute
+	jwksRefreshInterval  = time.Hour
+	jwksMinRefreshPeriod = time.Minute
+	// name of the client config and timeouts used to fetch the JWKS
+	jwksProvider = "jwks"
+
+	malformedTokenErrorMessage   = "malformed jwt: %s"
+	tokenExpiredErrorMessage     = "the access token expired at %s"
+	tokenNotValidYetErrorMessage = "the access token is not valid before %s"
+	unsupportedAlgErrorMessage   = "unsupported jwt signing algorithm %s"
+	unknownKeyErrorMessage       = "no verification key matches kid %q"
+	invalidSignatureErrorMessage = "invalid jwt signature"
+	invalidPublicKeyErrorMessage = "failed to load public key %s: %s"
+	fetchJwksErrorMessage        = "failed to fetch jwks from %s: %s"
+)
@@ -0,0 +1,181 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type Claims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	IssuedAt  int64           `json:"iat"`
+	Scope     string          `json:"scope"`
+
+	Profile struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	} `json:"https://api.openai.com/profile"`
+	Auth struct {
+		UserID         string `json:"user_id"`
+		AccountID      string `json:"chatgpt_account_id"`
+		PlanType       string `json:"chatgpt_plan_type"`
+		OrganizationID string `json:"organization_id"`
+	} `json:"https://api.openai.com/auth"`
+	Email string `json:"email"`
+}
+
+// Identity is who the access token belongs to, as far as the token itself tells.
+type Identity struct {
+	Email     string    `json:"email"`
+	UserID    string    `json:"user_id"`
+	AccountID string    `json:"account_id,omitempty"`
+	Plan      string    `json:"plan,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Verified  bool      `json:"verified"`
+}
+
+type Token struct {
+	Header    Header
+	Claims    Claims
+	Verified  bool
+	signed    string
+	signature []byte
+}
+
+// IsJWT tells jwts apart from api keys, a jwt header always starts with '{"'.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// Parse decodes a token without checking anything about it.
+func Parse(token string) (*Token, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf(malformedTokenErrorMessage, "expected 3 segments")
+	}
+
+	var t Token
+	if err := decodeSegment(parts[0], &t.Header); err != nil {
+		return nil, fmt.Errorf(malformedTokenErrorMessage, "header: "+err.Error())
+	}
+	if err := decodeSegment(parts[1], &t.Claims); err != nil {
+		return nil, fmt.Errorf(malformedTokenErrorMessage, "payload: "+err.Error())
+	}
+	signature, err := decodeBase64Url(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf(malformedTokenErrorMessage, "signature: "+err.Error())
+	}
+	t.signature = signature
+	t.signed = parts[0] + "." + parts[1]
+
+	return &t, nil
+}
+
+// Inspect parses the token, verifies its signature when keys are configured and checks exp and nbf.
+func Inspect(token string) (*Token, error) {
+	t, err := Parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifier := DefaultVerifier(); verifier.Enabled() {
+		if err := verifier.Verify(t); err != nil {
+			return nil, err
+		}
+		t.Verified = true
+	}
+
+	if err := t.CheckTime(time.Now(), clockSkew()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Token) CheckTime(now time.Time, skew time.Duration) error {
+	if t.Claims.ExpiresAt != 0 {
+		expiresAt := time.Unix(t.Claims.ExpiresAt, 0)
+		if now.After(expiresAt.Add(skew)) {
+			return fmt.Errorf(tokenExpiredErrorMessage, expiresAt.Format(time.RFC3339))
+		}
+	}
+	if t.Claims.NotBefore != 0 {
+		notBefore := time.Unix(t.Claims.NotBefore, 0)
+		if now.Before(notBefore.Add(-skew)) {
+			return fmt.Errorf(tokenNotValidYetErrorMessage, notBefore.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func (t *Token) Identity() Identity {
+	identity := Identity{
+		Email:     t.Claims.Profile.Email,
+		UserID:    t.Claims.Auth.UserID,
+		AccountID: t.Claims.Auth.AccountID,
+		Plan:      t.Claims.Auth.PlanType,
+		Issuer:    t.Claims.Issuer,
+		Verified:  t.Verified,
+	}
+	if identity.Email == "" {
+		identity.Email = t.Claims.Email
+	}
+	if identity.UserID == "" {
+		identity.UserID = t.Claims.Subject
+	}
+	if t.Claims.ExpiresAt != 0 {
+		identity.ExpiresAt = time.Unix(t.Claims.ExpiresAt, 0)
+	}
+	return identity
+}
+
+// GetIdentity returns the identity the authorization middleware found in the request's access token.
+func GetIdentity(c *gin.Context) (Identity, bool) {
+	value, ok := c.Get(IdentityKey)
+	if !ok {
+		return Identity{}, false
+	}
+	identity, ok := value.(Identity)
+	return identity, ok
+}
+
+func clockSkew() time.Duration {
+	skew, err := time.ParseDuration(os.Getenv("JWT_CLOCK_SKEW"))
+	if err != nil || skew < 0 {
+		return defaultClockSkew
+	}
+	return skew
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := decodeBase64Url(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBase64Url accepts segments with or without padding, some issuers keep it.
+func decodeBase64Url(segment string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, errors.New("invalid base64url encoding")
+	}
+	return data, nil
+}
@@ -0,0 +1,289 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/linweiyuan/go-logger/logger"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+// Verifier checks token signatures against public keys from PEM files and a JWKS endpoint.
+type Verifier struct {
+	jwksUrl string
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey // by kid
+	staticKeys  []crypto.PublicKey          // PEM keys have no kid, any of them may match
+	lastFetch   time.Time
+	lastAttempt time.Time
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var (
+	defaultVerifier     *Verifier
+	defaultVerifierOnce sync.Once
+)
+
+// DefaultVerifier is configured by JWT_JWKS_URL and JWT_PUBLIC_KEYS (comma separated PEM files).
+func DefaultVerifier() *Verifier {
+	defaultVerifierOnce.Do(func() {
+		defaultVerifier = NewVerifier(os.Getenv("JWT_JWKS_URL"))
+		for _, path := range strings.Split(os.Getenv("JWT_PUBLIC_KEYS"), ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			if err := defaultVerifier.AddPEMFile(path); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+	})
+	return defaultVerifier
+}
+
+func NewVerifier(jwksUrl string) *Verifier {
+	return &Verifier{
+		jwksUrl: jwksUrl,
+		keys:    map[string]crypto.PublicKey{},
+	}
+}
+
+func (v *Verifier) Enabled() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.jwksUrl != "" || len(v.staticKeys) != 0
+}
+
+func (v *Verifier) AddKey(kid string, key crypto.PublicKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if kid == "" {
+		v.staticKeys = append(v.staticKeys, key)
+	} else {
+		v.keys[kid] = key
+	}
+}
+
+func (v *Verifier) AddPEMFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf(invalidPublicKeyErrorMessage, path, err.Error())
+	}
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var key crypto.PublicKey
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf(invalidPublicKeyErrorMessage, path, err.Error())
+			}
+			key = certificate.PublicKey
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		}
+		if err != nil {
+			return fmt.Errorf(invalidPublicKeyErrorMessage, path, err.Error())
+		}
+		v.AddKey("", key)
+	}
+	return nil
+}
+
+func (v *Verifier) Verify(t *Token) error {
+	hash, err := signingHash(t.Header.Alg)
+	if err != nil {
+		return err
+	}
+
+	candidates := v.candidates(t.Header.Kid)
+	if len(candidates) == 0 {
+		return fmt.Errorf(unknownKeyErrorMessage, t.Header.Kid)
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(t.signed))
+	digest := hasher.Sum(nil)
+	for _, key := range candidates {
+		if verifySignature(t.Header.Alg, key, hash, digest, t.signature) {
+			return nil
+		}
+	}
+	return errors.New(invalidSignatureErrorMessage)
+}
+
+// candidates looks the kid up in the JWKS, fetching it again when the kid is unknown or the keys are stale.
+func (v *Verifier) candidates(kid string) []crypto.PublicKey {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.lastFetch) > jwksRefreshInterval
+	v.mu.RUnlock()
+
+	if v.jwksUrl != "" && (!ok || stale) {
+		v.fetch()
+		v.mu.RLock()
+		key, ok = v.keys[kid]
+		v.mu.RUnlock()
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	candidates := append([]crypto.PublicKey(nil), v.staticKeys...)
+	if ok {
+		candidates = append([]crypto.PublicKey{key}, candidates...)
+	}
+	return candidates
+}
+
+func (v *Verifier) fetch() {
+	v.mu.Lock()
+	if time.Since(v.lastAttempt) < jwksMinRefreshPeriod {
+		v.mu.Unlock()
+		return
+	}
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	req, _ := api.NewUpstreamRequest(context.Background(), jwksProvider, http.MethodGet, v.jwksUrl, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := api.GetClient(jwksProvider).Do(req)
+	if err != nil {
+		logger.Error(fmt.Sprintf(fetchJwksErrorMessage, v.jwksUrl, err.Error()))
+		return
+	}
+	defer resp.Body.Close()
+
+	var keySet jwks
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(fmt.Sprintf(fetchJwksErrorMessage, v.jwksUrl, resp.Status))
+		return
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		logger.Error(fmt.Sprintf(fetchJwksErrorMessage, v.jwksUrl, err.Error()))
+		return
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range keySet.Keys {
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.lastFetch = time.Now()
+	v.mu.Unlock()
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64Url(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64Url(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf(unsupportedAlgErrorMessage, k.Crv)
+		}
+		x, err := decodeBase64Url(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64Url(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf(unsupportedAlgErrorMessage, k.Kty)
+	}
+}
+
+func signingHash(alg string) (crypto.Hash, error) {
+	if len(alg) == 5 {
+		switch alg[:2] {
+		case "RS", "PS", "ES":
+			switch alg[2:] {
+			case "256":
+				return crypto.SHA256, nil
+			case "384":
+				return crypto.SHA384, nil
+			case "512":
+				return crypto.SHA512, nil
+			}
+		}
+	}
+	// "none" and the HMAC algorithms can not be checked with public keys
+	return 0, fmt.Errorf(unsupportedAlgErrorMessage, alg)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest []byte, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(key, hash, digest, signature, nil) == nil
+		}
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
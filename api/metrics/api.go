@@ -0,0 +1,10 @@
+package metrics
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+)
+
+func GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, Snapshot())
+}
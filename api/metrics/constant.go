@@ -0,0 +1,5 @@
+package metrics
+
+const (
+	PanicsRecovered = "panics_recovered"
+)
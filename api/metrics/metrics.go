@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	counters = map[string]*atomic.Int64{}
+	mu       sync.RWMutex
+)
+
+func Inc(name string) {
+	Add(name, 1)
+}
+
+func Add(name string, delta int64) {
+	counter(name).Add(delta)
+}
+
+func Get(name string) int64 {
+	return counter(name).Load()
+}
+
+// Snapshot returns the current value of every counter.
+func Snapshot() map[string]int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	snapshot := make(map[string]int64, len(counters))
+	for name, value := range counters {
+		snapshot[name] = value.Load()
+	}
+	return snapshot
+}
+
+func counter(name string) *atomic.Int64 {
+	mu.RLock()
+	value, ok := counters[name]
+	mu.RUnlock()
+	if ok {
+		return value
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if value, ok = counters[name]; !ok {
+		value = &atomic.Int64{}
+		counters[name] = value
+	}
+	return value
+}
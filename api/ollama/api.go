@@ -0,0 +1,264 @@
+package ollama
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// Routes maps "METHOD /path" of the ollama endpoints, which share the /api prefix with the pandora compatible
+// routes, to their handlers.
+var Routes = map[string]gin.HandlerFunc{
+	http.MethodPost + " /api/chat":       Chat,
+	http.MethodPost + " /api/generate":   Generate,
+	http.MethodGet + " /api/tags":        Tags,
+	http.MethodPost + " /api/embeddings": Embeddings,
+	http.MethodPost + " /api/embed":      Embed,
+}
+
+// Paths holds the paths of Routes.
+var Paths = routePaths()
+
+func routePaths() map[string]bool {
+	paths := map[string]bool{}
+	for route := range Routes {
+		_, path, _ := strings.Cut(route, " ")
+		paths[path] = true
+	}
+	return paths
+}
+
+func Chat(c *gin.Context) {
+	var request ChatRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	if request.Model == "" {
+		abortWithError(c, http.StatusBadRequest, emptyModelErrorMessage)
+		return
+	}
+
+	respond(c, convertChatRequest(request), request.Stream == nil || *request.Stream, true)
+}
+
+func Generate(c *gin.Context) {
+	var request GenerateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	if request.Model == "" {
+		abortWithError(c, http.StatusBadRequest, emptyModelErrorMessage)
+		return
+	}
+
+	// an empty prompt is used by clients to load a model, there is nothing to load here
+	if request.Prompt == "" {
+		c.JSON(http.StatusOK, newResponse(request.Model, "", nil, false, true))
+		return
+	}
+
+	respond(c, convertGenerateRequest(request), request.Stream == nil || *request.Stream, false)
+}
+
+func respond(c *gin.Context, chatRequest backend.ChatCompletionRequest, stream bool, chat bool) {
+	start := time.Now()
+	model := chatRequest.Model
+	if !stream {
+		completion, err := backend.Complete(c, chatRequest)
+		if err != nil {
+			abortWithBackendError(c, err)
+			return
+		}
+
+		response := newResponse(model, "", nil, chat, true)
+		if len(completion.Choices) != 0 && completion.Choices[0].Message != nil {
+			message := completion.Choices[0].Message
+			response = newResponse(model, message.Text(), convertToolCalls(message.ToolCalls), chat, true)
+			response.DoneReason = convertFinishReason(completion.Choices[0].FinishReason)
+		}
+		setStatistics(&response, completion.Usage, start)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	chatRequest.StreamOptions = &backend.StreamOptions{IncludeUsage: true}
+
+	// backend.Stream swaps c.Writer while the backend runs, keep the client writer
+	w := c.Writer
+	started := false
+	write := func(response ChatResponse) {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		data, _ := json.Marshal(response)
+		w.Write(append(data, '\n'))
+		w.Flush()
+	}
+
+	var toolCalls []backend.ToolCall
+	var usage *backend.Usage
+	finishReason := ""
+	err := backend.Stream(c, chatRequest, func(chunk backend.ChatCompletion) {
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			if choice.Delta == nil {
+				continue
+			}
+			toolCalls = backend.MergeToolCalls(toolCalls, choice.Delta.ToolCalls)
+			if text := choice.Delta.Text(); text != "" {
+				write(newResponse(model, text, nil, chat, false))
+			}
+		}
+	})
+	if err != nil {
+		if !started {
+			abortWithBackendError(c, err)
+			return
+		}
+		// the stream has started, ollama ends it with an error line
+		_, e := backend.ToError(err)
+		logger.Warn(e.Message)
+		data, _ := json.Marshal(gin.H{"error": e.Message})
+		w.Write(append(data, '\n'))
+		w.Flush()
+		return
+	}
+
+	// ollama sends tool calls in one piece right before the final message
+	if len(toolCalls) != 0 {
+		write(newResponse(model, "", convertToolCalls(toolCalls), chat, false))
+	}
+	response := newResponse(model, "", nil, chat, true)
+	response.DoneReason = convertFinishReason(finishReason)
+	setStatistics(&response, usage, start)
+	write(response)
+}
+
+func newResponse(model string, text string, toolCalls []ToolCall, chat bool, done bool) ChatResponse {
+	response := ChatResponse{
+		Model:     model,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Done:      done,
+	}
+	if chat {
+		response.Message = &Message{Role: "assistant", Content: text, ToolCalls: toolCalls}
+	} else {
+		response.Response = &text
+	}
+	return response
+}
+
+func setStatistics(response *ChatResponse, usage *backend.Usage, start time.Time) {
+	duration := time.Since(start).Nanoseconds()
+	response.TotalDuration = duration
+	response.EvalDuration = duration
+	if usage != nil {
+		response.PromptEvalCount = usage.PromptTokens
+		response.EvalCount = usage.CompletionTokens
+	}
+}
+
+func Tags(c *gin.Context) {
+	names := os.Getenv("OLLAMA_MODELS")
+	if names == "" {
+		names = defaultModels
+	}
+
+	models := []ModelInfo{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		digest := sha256.Sum256([]byte(name))
+		family, _, _ := strings.Cut(name, "-")
+		models = append(models, ModelInfo{
+			Name:       name,
+			Model:      name,
+			ModifiedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			Digest:     hex.EncodeToString(digest[:]),
+			Details: ModelDetails{
+				Format:   "api",
+				Family:   family,
+				Families: []string{family},
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
+
+func Embeddings(c *gin.Context) {
+	var request EmbeddingsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	response, err := backend.Embed(c, backend.EmbeddingRequest{Model: request.Model, Input: request.Prompt})
+	if err != nil {
+		abortWithBackendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"embedding": response.Data[0].Embedding})
+}
+
+func Embed(c *gin.Context) {
+	var request EmbedRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	response, err := backend.Embed(c, backend.EmbeddingRequest{Model: request.Model, Input: request.Input})
+	if err != nil {
+		abortWithBackendError(c, err)
+		return
+	}
+
+	embeddings := make([][]float64, len(response.Data))
+	for i, embedding := range response.Data {
+		if embedding.Index >= 0 && embedding.Index < len(embeddings) {
+			embeddings[embedding.Index] = embedding.Embedding
+		} else {
+			embeddings[i] = embedding.Embedding
+		}
+	}
+	result := gin.H{"model": request.Model, "embeddings": embeddings}
+	if response.Usage != nil {
+		result["prompt_eval_count"] = response.Usage.PromptTokens
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ollama clients expect {"error": message} instead of the openai error shape
+func abortWithBackendError(c *gin.Context, err error) {
+	statusCode, e := backend.ToError(err)
+	abortWithError(c, statusCode, e.Message)
+}
+
+func abortWithError(c *gin.Context, statusCode int, message string) {
+	logger.Warn(message)
+
+	c.AbortWithStatusJSON(statusCode, gin.H{"error": message})
+}
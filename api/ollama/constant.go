@@ -0,0 +1,8 @@
+package ollama
+
+const (
+	parseJsonErrorMessage  = "failed to parse json request body"
+	emptyModelErrorMessage = "model is required"
+
+	defaultModels = "gpt-4o,gpt-4,gpt-3.5-turbo"
+)
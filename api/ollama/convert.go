@@ -0,0 +1,145 @@
+package ollama
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	http "github.com/bogdanfinn/fhttp"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+)
+
+func convertChatRequest(request ChatRequest) backend.ChatCompletionRequest {
+	chatRequest := backend.ChatCompletionRequest{Model: request.Model}
+	applyOptions(&chatRequest, request.Options, request.Format)
+
+	// ollama has no tool call ids, pair tool results with calls in order
+	var pendingCallIDs []string
+	callCount := 0
+	for _, message := range request.Messages {
+		chatMessage := backend.ChatMessage{Role: message.Role, Content: message.Content}
+		if len(message.Images) != 0 {
+			chatMessage.Content = imageParts(message.Content, message.Images)
+		}
+		for _, toolCall := range message.ToolCalls {
+			callCount++
+			id := fmt.Sprintf("call_%d_%s", callCount, toolCall.Function.Name)
+			pendingCallIDs = append(pendingCallIDs, id)
+			arguments, _ := json.Marshal(toolCall.Function.Arguments)
+			chatMessage.ToolCalls = append(chatMessage.ToolCalls, backend.ToolCall{
+				ID:       id,
+				Type:     "function",
+				Function: backend.FunctionCall{Name: toolCall.Function.Name, Arguments: string(arguments)},
+			})
+		}
+		if message.Role == "tool" {
+			if len(pendingCallIDs) != 0 {
+				chatMessage.ToolCallID = pendingCallIDs[0]
+				pendingCallIDs = pendingCallIDs[1:]
+			} else {
+				callCount++
+				chatMessage.ToolCallID = fmt.Sprintf("call_%d", callCount)
+			}
+		}
+		chatRequest.Messages = append(chatRequest.Messages, chatMessage)
+	}
+
+	for _, tool := range request.Tools {
+		chatRequest.Tools = append(chatRequest.Tools, backend.Tool{
+			Type: "function",
+			Function: backend.FunctionDefinition{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			},
+		})
+	}
+
+	return chatRequest
+}
+
+func convertGenerateRequest(request GenerateRequest) backend.ChatCompletionRequest {
+	chatRequest := backend.ChatCompletionRequest{Model: request.Model}
+	applyOptions(&chatRequest, request.Options, request.Format)
+
+	if request.System != "" {
+		chatRequest.Messages = append(chatRequest.Messages, backend.ChatMessage{Role: "system", Content: request.System})
+	}
+	message := backend.ChatMessage{Role: "user", Content: request.Prompt}
+	if len(request.Images) != 0 {
+		message.Content = imageParts(request.Prompt, request.Images)
+	}
+	chatRequest.Messages = append(chatRequest.Messages, message)
+
+	return chatRequest
+}
+
+func applyOptions(chatRequest *backend.ChatCompletionRequest, options *Options, format json.RawMessage) {
+	if options != nil {
+		chatRequest.Temperature = options.Temperature
+		chatRequest.TopP = options.TopP
+		chatRequest.MaxTokens = options.NumPredict
+		chatRequest.Stop = options.Stop
+		chatRequest.Seed = options.Seed
+		chatRequest.PresencePenalty = options.PresencePenalty
+		chatRequest.FrequencyPenalty = options.FrequencyPenalty
+	}
+
+	// format is either "json" or a json schema
+	var formatName string
+	if len(format) == 0 || string(format) == "null" {
+		return
+	}
+	if err := json.Unmarshal(format, &formatName); err == nil {
+		if formatName == "json" {
+			chatRequest.ResponseFormat = map[string]any{"type": "json_object"}
+		}
+		return
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(format, &schema); err == nil {
+		chatRequest.ResponseFormat = map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   "response",
+				"schema": schema,
+			},
+		}
+	}
+}
+
+func imageParts(text string, images []string) []backend.ContentPart {
+	var parts []backend.ContentPart
+	if text != "" {
+		parts = append(parts, backend.ContentPart{Type: "text", Text: text})
+	}
+	for _, image := range images {
+		mediaType := "image/png"
+		if data, err := base64.StdEncoding.DecodeString(image); err == nil {
+			mediaType = http.DetectContentType(data)
+		}
+		parts = append(parts, backend.ContentPart{
+			Type:     "image_url",
+			ImageURL: &backend.ImageURL{URL: "data:" + mediaType + ";base64," + image},
+		})
+	}
+	return parts
+}
+
+func convertToolCalls(toolCalls []backend.ToolCall) []ToolCall {
+	var calls []ToolCall
+	for _, toolCall := range toolCalls {
+		arguments := map[string]any{}
+		json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments)
+		calls = append(calls, ToolCall{Function: ToolCallFunction{Name: toolCall.Function.Name, Arguments: arguments}})
+	}
+	return calls
+}
+
+func convertFinishReason(reason string) string {
+	if reason == "length" {
+		return "length"
+	}
+	return "stop"
+}
@@ -3,11 +3,11 @@ package patgpt
 import (
 	"bufio"
 	"bytes"
-	"encoding/base64"
-	"encoding/binary"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +17,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/backend"
+	"github.com/dhso/go-chatgpt-api/api/embeddings"
 	"github.com/linweiyuan/go-logger/logger"
 )
 
@@ -101,7 +103,9 @@ type OpenAIRequest struct {
 type OpenAIEmbeddingRequest struct {
 	Input          any    `json:"input"`
 	Model          string `json:"model"`
-	EncodingFormat string `json:"encoding_format"`
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	Dimensions     int    `json:"dimensions,omitempty"`
+	User           string `json:"user,omitempty"`
 }
 
 type OpenAIUsageResponse struct {
@@ -111,13 +115,16 @@ type OpenAIUsageResponse struct {
 }
 
 func CreateCompletions(c *gin.Context) {
-	CreateChatCompletions(c)
+	backend.CreateCompletions(c, CreateChatCompletions)
 }
 
 func CreateChatCompletions(c *gin.Context) {
 	reqBody, _ := io.ReadAll(c.Request.Body)
 	var request OpenAIRequest
-	json.Unmarshal(reqBody, &request)
+	if err := json.Unmarshal(reqBody, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
 
 	url := HandleUrl(c, request)
 	body := HandleBody(c, request, reqBody)
@@ -134,9 +141,7 @@ func CreateChatCompletions(c *gin.Context) {
 		case http.StatusForbidden:
 			logger.Error(fmt.Sprintf(api.AccountForbiddenErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
 		}
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 	} else {
 		HandleResponse(c, resp, request)
 	}
@@ -162,12 +167,19 @@ func HandleBody(c *gin.Context, request OpenAIRequest, body []byte) []byte {
 		case []interface{}:
 			// 循环处理messages
 			for j, content := range contents {
-				_content := content.(map[string]interface{})
+				_content, ok := content.(map[string]interface{})
+				if !ok {
+					continue
+				}
 				if _content["type"] == "image_url" {
-					base64Str := _content["image_url"].(map[string]interface{})["url"].(string)
+					imageUrl, _ := _content["image_url"].(map[string]interface{})
+					base64Str, _ := imageUrl["url"].(string)
+					if base64Str == "" {
+						continue
+					}
 					if !strings.HasPrefix(base64Str, "data:") {
 						// 访问图片链接转成base64
-						base64Str = api.GetImageBase64Str(base64Str)
+						base64Str = api.GetImageBase64Str(c.Request.Context(), base64Str)
 					}
 					base64Parts := strings.Split(base64Str, ";")
 					if len(base64Parts) < 2 {
@@ -183,7 +195,7 @@ func HandleBody(c *gin.Context, request OpenAIRequest, body []byte) []byte {
 							"data":       data,
 						},
 					}
-					request.Messages[i].Content.([]interface{})[j] = content
+					contents[j] = content
 				}
 			}
 		}
@@ -226,6 +238,9 @@ func HandleCompletionsResponseWithStream(c *gin.Context, resp *http.Response) {
 
 		line, err := reader.ReadString('\n')
 		if err != nil {
+			if err != io.EOF {
+				api.AbortWithError(c, http.StatusBadGateway, err.Error())
+			}
 			break
 		}
 
@@ -241,12 +256,16 @@ func HandleCompletionsResponseWithStream(c *gin.Context, resp *http.Response) {
 			} else {
 				var jsonLine map[string]interface{}
 				err = json.Unmarshal([]byte(line_without_data), &jsonLine)
-				if err == nil {
-					choices := jsonLine["choices"].([]interface{})
-					delta := choices[0].(map[string]interface{})["delta"].(map[string]interface{})
+				if err == nil && jsonLine["choices"] == nil {
+					// the stream failed upstream, report it as the final event
+					api.AbortWithUpstreamMap(c, http.StatusBadGateway, jsonLine)
+					return
+				}
+				if choices, _ := jsonLine["choices"].([]interface{}); len(choices) != 0 {
+					choice, _ := choices[0].(map[string]interface{})
+					delta, _ := choice["delta"].(map[string]interface{})
 					if delta["role"] == "assistant" && (delta["tool_calls"] != nil || delta["function_call"] != nil) && delta["content"] == nil {
-						choices[0].(map[string]interface{})["delta"].(map[string]interface{})["content"] = nil
-						jsonLine["choices"] = choices
+						delta["content"] = nil
 					}
 				}
 				lineBytes, err := json.Marshal(jsonLine)
@@ -266,25 +285,13 @@ func HandleCompletionsResponseWithStream(c *gin.Context, resp *http.Response) {
 func HandleCompletionsResponse(c *gin.Context, resp *http.Response) {
 	responseMap := make(map[string]interface{})
 	json.NewDecoder(resp.Body).Decode(&responseMap)
-	errorCode := responseMap["error_code"].(float64)
-	if errorCode == 429 {
-		errorMessage := responseMap["msg"].(string)
-		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-			"error": gin.H{
-				"message": errorMessage,
-				"type":    "rate_limit_error",
-				"param":   "",
-				"code":    "invalid_api_key",
-			},
-		})
-		return
-	}
-	if responseMap["data"] == nil && responseMap["msg"] != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(responseMap["msg"].(string)))
+	// patsnap answers 200 with {"msg", "error_code"} when the completion failed
+	jsonData, ok := responseMap["data"].(map[string]interface{})
+	if !ok {
+		api.AbortWithUpstreamMap(c, http.StatusBadGateway, responseMap)
 		return
 	}
 
-	jsonData := responseMap["data"].(map[string]interface{})
 	finishReason := jsonData["finish_reason"]
 	if finishReason == nil {
 		finishReason = ""
@@ -319,8 +326,8 @@ func HandleCompletionsResponse(c *gin.Context, resp *http.Response) {
 		// choices[0].Message.Role = "function"
 		choices[0].Message.FunctionCall = functionCall
 	}
-	model := jsonData["model"].(string)
-	usage := jsonData["usage"].(map[string]interface{})
+	model, _ := jsonData["model"].(string)
+	usage, _ := jsonData["usage"].(map[string]interface{})
 	systemFingerprint := ""
 	if jsonData["system_fingerprint"] != nil {
 		systemFingerprint = jsonData["system_fingerprint"].(string)
@@ -339,7 +346,7 @@ func HandleCompletionsResponse(c *gin.Context, resp *http.Response) {
 }
 
 func HandlePost(c *gin.Context, url string, data []byte, request OpenAIRequest) (*http.Response, error) {
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodPost, url, bytes.NewBuffer(data))
 	req.Header.Set(api.AuthorizationHeader, api.GetBasicToken(c))
 	req.Header.Set("X-Ai-Engine", api.ModelMappping(request.Model))
 	req.Header.Set("Content-Type", "application/json")
@@ -358,12 +365,12 @@ func HandlePost(c *gin.Context, url string, data []byte, request OpenAIRequest)
 		}
 		var modifiedData []byte
 		modifiedData, _ = json.Marshal(modifiedRequest)
-		modifiedReq, _ = http.NewRequest(http.MethodPost, url, bytes.NewBuffer(modifiedData))
+		modifiedReq, _ = api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodPost, url, bytes.NewBuffer(modifiedData))
 		modifiedReq.Header = req.Header.Clone()
 	}
-	resp, err := api.Client.Do(modifiedReq)
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(modifiedReq)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(modifiedReq, err).Error())
 		return nil, err
 	}
 
@@ -372,20 +379,18 @@ func HandlePost(c *gin.Context, url string, data []byte, request OpenAIRequest)
 
 func GetBillingSubscription(c *gin.Context) {
 	url := getPatApiUrlPrefix() + patApiCostUsage
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodGet, url, nil)
 	req.Header.Set(api.AuthorizationHeader, api.GetBasicToken(c))
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 		return
 	}
 	responseMap := make(map[string]interface{})
@@ -406,20 +411,18 @@ func GetBillingSubscription(c *gin.Context) {
 
 func GetBillingUsage(c *gin.Context) {
 	url := getPatApiUrlPrefix() + patApiCostUsage
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodGet, url, nil)
 	req.Header.Set(api.AuthorizationHeader, api.GetBasicToken(c))
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 		return
 	}
 	responseMap := make(map[string]interface{})
@@ -435,92 +438,183 @@ func GetBillingUsage(c *gin.Context) {
 func CreateEmbeddings(c *gin.Context) {
 	reqBody, _ := io.ReadAll(c.Request.Body)
 	var request OpenAIEmbeddingRequest
-	json.Unmarshal(reqBody, &request)
+	if err := json.Unmarshal(reqBody, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	inputs, ok := embeddings.SplitInput(request.Input)
+	if !ok {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidEmbeddingsInputErrorMessage, "input")
+		return
+	}
+
 	url := getPatApiUrlPrefix() + patApiCreateEmbeddings
-	results := make(map[string]interface{})
-	switch inputs := request.Input.(type) {
-	case string:
-		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBody))
-		results = doEmbeddingsRequest(c, req, request)
-	case []interface{}:
-		// 循环处理messages
-		embeddings := make([]map[string]interface{}, len(inputs))
-		var wg sync.WaitGroup
-		mu := sync.Mutex{}
-		for i, input := range inputs {
-			wg.Add(1)
-			go func(_i int, _input interface{}) {
-				defer wg.Done()
+	authorization := api.GetBasicToken(c)
+	account := c.GetString(api.EmailKey)
+	results := make([]map[string]interface{}, len(inputs))
+	usages := make([]map[string]interface{}, len(inputs))
+	errs := make([]*embeddingsError, len(inputs))
+	var model interface{}
+
+	// only cache misses are sent upstream
+	keys := make([]string, len(inputs))
+	var misses []int
+	for i, input := range inputs {
+		keys[i] = embeddings.Key(request.Model, request.Dimensions, input)
+		if vector, ok := embeddings.DefaultCache.Get(keys[i]); ok {
+			results[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": vector}
+			continue
+		}
+		misses = append(misses, i)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for worker := 0; worker < embeddingsConcurrency(len(misses)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
 				_request := request
-				_request.Input = _input
-				_reqBody, _ := json.Marshal(_request)
-				req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(_reqBody))
-				result := doEmbeddingsRequest(c, req, request)
-				mu.Lock()
-				embedding := map[string]interface{}{}
-				if result != nil {
-					embedding = result["data"].([]interface{})[0].(map[string]interface{})
-					embedding["index"] = _i
+				_request.Input = inputs[i]
+				// vectors are encoded once all sub requests are back
+				_request.EncodingFormat = ""
+				if !embeddings.SupportsDimensions(_request.Model) {
+					_request.Dimensions = 0
+				}
+				result, err := doEmbeddingsRequest(c.Request.Context(), url, authorization, account, _request)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+
+				data, _ := result["data"].([]interface{})
+				if len(data) == 0 {
+					errs[i] = &embeddingsError{statusCode: http.StatusBadGateway, message: emptyEmbeddingsErrorMessage}
+					continue
+				}
+				embedding, _ := data[0].(map[string]interface{})
+				if embedding == nil {
+					errs[i] = &embeddingsError{statusCode: http.StatusBadGateway, message: emptyEmbeddingsErrorMessage}
+					continue
 				}
-				embeddings[_i] = embedding
-				results = map[string]interface{}{
-					"object": result["object"],
-					"model":  result["model"],
-					"data":   embeddings,
-					"usage":  result["usage"].(map[string]interface{}),
+				embedding["index"] = i
+				results[i] = embedding
+				if vector, ok := embeddings.Vector(embedding["embedding"]); ok {
+					embeddings.DefaultCache.Put(keys[i], vector)
+				}
+				usages[i], _ = result["usage"].(map[string]interface{})
+				mu.Lock()
+				if model == nil {
+					model = result["model"]
 				}
 				mu.Unlock()
-			}(i, input)
+			}
+		}()
+	}
+	for _, i := range misses {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// report every failed input in a single error, the status of the first failure wins
+	var failed *embeddingsError
+	var failedIndexes []string
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failed == nil {
+			failed = err
+		}
+		failedIndexes = append(failedIndexes, strconv.Itoa(i))
+	}
+	if failed != nil {
+		message := fmt.Sprintf(embeddingsFailedErrorMessage, len(failedIndexes), len(inputs), strings.Join(failedIndexes, ", "), failed.message)
+		api.AbortWithParamError(c, failed.statusCode, message, "input")
+		return
+	}
+
+	promptTokens, totalTokens := 0.0, 0.0
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		if tokens, ok := usage["prompt_tokens"].(float64); ok {
+			promptTokens += tokens
+		}
+		if tokens, ok := usage["total_tokens"].(float64); ok {
+			totalTokens += tokens
 		}
-		wg.Wait()
 	}
-	c.JSON(http.StatusOK, results)
+
+	embeddings.Normalize(results, request.EncodingFormat, request.Dimensions)
+
+	if model == nil {
+		model = request.Model
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"model":  model,
+		"data":   results,
+		"usage": gin.H{
+			"prompt_tokens": promptTokens,
+			"total_tokens":  totalTokens,
+		},
+	})
 }
 
-func doEmbeddingsRequest(c *gin.Context, req *http.Request, request OpenAIEmbeddingRequest) map[string]interface{} {
-	req.Header.Set(api.AuthorizationHeader, api.GetBasicToken(c))
+func embeddingsConcurrency(inputs int) int {
+	concurrency, err := strconv.Atoi(os.Getenv("EMBEDDINGS_CONCURRENCY"))
+	if err != nil || concurrency <= 0 {
+		concurrency = defaultEmbeddingsConcurrency
+	}
+	if concurrency > inputs {
+		concurrency = inputs
+	}
+	return concurrency
+}
+
+type embeddingsError struct {
+	statusCode int
+	message    string
+}
+
+func doEmbeddingsRequest(ctx context.Context, url string, authorization string, account string, request OpenAIEmbeddingRequest) (map[string]interface{}, *embeddingsError) {
+	reqBody, _ := json.Marshal(request)
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderPatsnap, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	req.Header.Set(api.AuthorizationHeader, authorization)
 	req.Header.Set("X-Ai-Engine", "openai")
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	if ctx.Err() != nil {
+		return nil, &embeddingsError{statusCode: http.StatusRequestTimeout, message: ctx.Err().Error()}
+	}
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
-		return nil
+		return nil, &embeddingsError{statusCode: http.StatusInternalServerError, message: api.UpstreamCause(req, err).Error()}
 	}
 	defer resp.Body.Close()
+
+	responseMap := make(map[string]interface{})
+	json.NewDecoder(resp.Body).Decode(&responseMap)
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
-			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
+			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, account))
 		case http.StatusForbidden:
-			logger.Error(fmt.Sprintf(api.AccountForbiddenErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
+			logger.Error(fmt.Sprintf(api.AccountForbiddenErrorMessage, account))
 		}
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
-		return nil
+		statusCode, err := api.UpstreamError(resp.StatusCode, responseMap)
+		return nil, &embeddingsError{statusCode: statusCode, message: err.Message}
 	}
-	responseMap := make(map[string]interface{})
-	json.NewDecoder(resp.Body).Decode(&responseMap)
-	if responseMap["data"] == nil {
-		return nil
-	}
-	jsonData := responseMap["data"].(map[string]interface{})
-	if request.EncodingFormat == "base64" {
-		for jd_idx, jd := range jsonData["data"].([]interface{}) {
-			// 将浮点数列表转换为字节数组
-			buf := new(bytes.Buffer)
-			for _, f := range jd.(map[string]interface{})["embedding"].([]interface{}) {
-				err := binary.Write(buf, binary.LittleEndian, float32(f.(float64)))
-				if err != nil {
-					fmt.Println("binary.Write failed:", err)
-				}
-			}
-			byteArray := buf.Bytes()
-			// 将字节数组转换为Base64字符串
-			base64Str := base64.StdEncoding.EncodeToString(byteArray)
-			jsonData["data"].([]interface{})[jd_idx].(map[string]interface{})["embedding"] = base64Str
-		}
-		return jsonData
+
+	jsonData, ok := responseMap["data"].(map[string]interface{})
+	if !ok {
+		statusCode, err := api.UpstreamError(http.StatusBadGateway, responseMap)
+		return nil, &embeddingsError{statusCode: statusCode, message: err.Message}
 	}
-	return jsonData
+	return jsonData, nil
 }
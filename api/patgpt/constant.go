@@ -20,6 +20,13 @@ const (
 	patApiAggregation           = "/compute/chatgpt_aggregation"
 	patApiCostUsage             = "/common/cost/usage"
 	patApiCreateEmbeddings      = "/compute/openai_embeddings"
+
+	defaultEmbeddingsConcurrency = 4
+
+	parseJsonErrorMessage              = "failed to parse json request body"
+	invalidEmbeddingsInputErrorMessage = "input must be a string, an array of strings, a token array or an array of token arrays"
+	emptyEmbeddingsErrorMessage        = "upstream returned no embedding"
+	embeddingsFailedErrorMessage       = "%d of %d inputs failed (index %s): %s"
 )
 
 func getPatApiUrlPrefix() string {
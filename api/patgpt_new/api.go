@@ -3,8 +3,6 @@ package patgpt_new
 import (
 	"bufio"
 	"bytes"
-	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +12,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/backend"
+	"github.com/dhso/go-chatgpt-api/api/embeddings"
 	"github.com/linweiyuan/go-logger/logger"
 )
 
@@ -55,7 +55,9 @@ type Message struct {
 type OpenAIEmbeddingRequest struct {
 	Input          any    `json:"input"`
 	Model          string `json:"model"`
-	EncodingFormat string `json:"encoding_format"`
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	Dimensions     int    `json:"dimensions,omitempty"`
+	User           string `json:"user,omitempty"`
 }
 
 type OpenAIUsageResponse struct {
@@ -65,13 +67,16 @@ type OpenAIUsageResponse struct {
 }
 
 func CreateCompletions(c *gin.Context) {
-	CreateChatCompletions(c)
+	backend.CreateCompletions(c, CreateChatCompletions)
 }
 
 func CreateChatCompletions(c *gin.Context) {
 	_body, _ := io.ReadAll(c.Request.Body)
 	var request OpenAIRequest
-	json.Unmarshal(_body, &request)
+	if err := json.Unmarshal(_body, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
 
 	url := getPatApiUrlPrefix() + patApiCreateChatCompletions
 
@@ -90,9 +95,7 @@ func CreateChatCompletions(c *gin.Context) {
 		case http.StatusForbidden:
 			logger.Error(fmt.Sprintf(api.AccountForbiddenErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
 		}
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 	} else {
 		HandleResponse(c, resp, request)
 	}
@@ -114,12 +117,19 @@ func HandleBody(c *gin.Context, request OpenAIRequest, body []byte) []byte {
 		case []interface{}:
 			// 循环处理messages
 			for j, content := range contents {
-				_content := content.(map[string]interface{})
+				_content, ok := content.(map[string]interface{})
+				if !ok {
+					continue
+				}
 				if _content["type"] == "image_url" {
-					base64Str := _content["image_url"].(map[string]interface{})["url"].(string)
+					imageUrl, _ := _content["image_url"].(map[string]interface{})
+					base64Str, _ := imageUrl["url"].(string)
+					if base64Str == "" {
+						continue
+					}
 					if !strings.HasPrefix(base64Str, "data:") {
 						// 访问图片链接转成base64
-						base64Str = api.GetImageBase64Str(base64Str)
+						base64Str = api.GetImageBase64Str(c.Request.Context(), base64Str)
 					}
 					base64Parts := strings.Split(base64Str, ";")
 					if len(base64Parts) < 2 {
@@ -135,7 +145,7 @@ func HandleBody(c *gin.Context, request OpenAIRequest, body []byte) []byte {
 							"data":       data,
 						},
 					}
-					request.Messages[i].Content.([]interface{})[j] = content
+					contents[j] = content
 				}
 			}
 		}
@@ -158,16 +168,16 @@ func HandleBody(c *gin.Context, request OpenAIRequest, body []byte) []byte {
 }
 
 func handlePost(c *gin.Context, url string, data []byte, request OpenAIRequest) (*http.Response, error) {
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodPost, url, bytes.NewBuffer(data))
 	req.Header.Set(api.AuthorizationHeader, api.GetBearerToken(c))
 	req.Header.Set("X-Ai-Engine", api.ModelMappping(request.Model))
 	if request.Stream {
 		req.Header.Set("Accept", "text/event-stream")
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return nil, err
 	}
 	return resp, nil
@@ -186,6 +196,9 @@ func HandleResponse(c *gin.Context, resp *http.Response, request OpenAIRequest)
 
 			line, err := reader.ReadString('\n')
 			if err != nil {
+				if err != io.EOF {
+					api.AbortWithError(c, http.StatusBadGateway, err.Error())
+				}
 				break
 			}
 
@@ -199,6 +212,10 @@ func HandleResponse(c *gin.Context, resp *http.Response, request OpenAIRequest)
 				line_without_data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 				if line_without_data == "finish" {
 					line = "data: [DONE]"
+				} else if responseMap := parseStreamError(line_without_data); responseMap != nil {
+					// the stream failed upstream, report it as the final event
+					api.AbortWithUpstreamMap(c, http.StatusBadGateway, responseMap)
+					return
 				} else {
 					line = "data: " + line_without_data
 				}
@@ -212,72 +229,158 @@ func HandleResponse(c *gin.Context, resp *http.Response, request OpenAIRequest)
 	}
 }
 
+// parseStreamError returns the payload of a data line that carries an error instead of a chunk.
+func parseStreamError(data string) map[string]interface{} {
+	var responseMap map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &responseMap); err != nil || responseMap["choices"] != nil {
+		return nil
+	}
+	if responseMap["error"] == nil && responseMap["error_code"] == nil && responseMap["msg"] == nil {
+		return nil
+	}
+	return responseMap
+}
+
 func CreateEmbeddings(c *gin.Context) {
 	body, _ := io.ReadAll(c.Request.Body)
 	var request OpenAIEmbeddingRequest
-	json.Unmarshal(body, &request)
+	if err := json.Unmarshal(body, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
 
-	url := getPatApiUrlPrefix() + patApiCreateEmbeddings
+	inputs, ok := embeddings.SplitInput(request.Input)
+	if !ok {
+		api.AbortWithParamError(c, http.StatusBadRequest, invalidEmbeddingsInputErrorMessage, "input")
+		return
+	}
+
+	// only cache misses are sent upstream, in a single batch
+	results := make([]map[string]interface{}, len(inputs))
+	keys := make([]string, len(inputs))
+	var misses []int
+	var missedInputs []interface{}
+	for i, input := range inputs {
+		keys[i] = embeddings.Key(request.Model, request.Dimensions, input)
+		if vector, ok := embeddings.DefaultCache.Get(keys[i]); ok {
+			results[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": vector}
+			continue
+		}
+		misses = append(misses, i)
+		missedInputs = append(missedInputs, input)
+	}
+
+	model := interface{}(request.Model)
+	usage := interface{}(gin.H{"prompt_tokens": 0, "total_tokens": 0})
+	if len(misses) != 0 {
+		upstreamRequest := request
+		upstreamRequest.Input = missedInputs
+		// vectors are cached as floats and encoded afterwards
+		upstreamRequest.EncodingFormat = ""
+		if !embeddings.SupportsDimensions(upstreamRequest.Model) {
+			upstreamRequest.Dimensions = 0
+		}
+		jsonData, done := doEmbeddingsRequest(c, upstreamRequest)
+		if done {
+			return
+		}
+
+		data, _ := jsonData["data"].([]interface{})
+		for j, item := range data {
+			embedding, _ := item.(map[string]interface{})
+			if embedding == nil {
+				continue
+			}
+			index := j
+			if value, ok := embedding["index"].(float64); ok {
+				index = int(value)
+			}
+			if index < 0 || index >= len(misses) {
+				continue
+			}
+			i := misses[index]
+			embedding["index"] = i
+			results[i] = embedding
+			if vector, ok := embeddings.Vector(embedding["embedding"]); ok {
+				embeddings.DefaultCache.Put(keys[i], vector)
+			}
+		}
+		for _, result := range results {
+			if result == nil {
+				api.AbortWithError(c, http.StatusBadGateway, emptyEmbeddingsErrorMessage)
+				return
+			}
+		}
+		if jsonData["model"] != nil {
+			model = jsonData["model"]
+		}
+		if jsonData["usage"] != nil {
+			usage = jsonData["usage"]
+		}
+	}
 
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	embeddings.Normalize(results, request.EncodingFormat, request.Dimensions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"model":  model,
+		"data":   results,
+		"usage":  usage,
+	})
+}
+
+func doEmbeddingsRequest(c *gin.Context, request OpenAIEmbeddingRequest) (map[string]interface{}, bool) {
+	body, _ := json.Marshal(request)
+	url := getPatApiUrlPrefix() + patApiCreateEmbeddings
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodPost, url, bytes.NewBuffer(body))
 	req.Header.Set(api.AuthorizationHeader, api.GetBearerToken(c))
 	req.Header.Set("X-Ai-Engine", "openai")
-	resp, err := api.Client.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
-		return
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
+		return nil, true
 	}
+
 	defer resp.Body.Close()
-	switch resp.StatusCode {
-	case http.StatusOK:
-		io.Copy(c.Writer, resp.Body)
-		return
-	case http.StatusUnauthorized:
-		logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
-	case http.StatusForbidden:
-		logger.Error(fmt.Sprintf(api.AccountForbiddenErrorMessage, c.GetString(c.Request.Header.Get(api.AuthorizationHeader))))
-	}
 	responseMap := make(map[string]interface{})
 	json.NewDecoder(resp.Body).Decode(&responseMap)
-	jsonData := responseMap["data"].(map[string]interface{})
-	if request.EncodingFormat == "base64" {
-		for jd_idx, jd := range jsonData["data"].([]interface{}) {
-			// 将浮点数列表转换为字节数组
-			buf := new(bytes.Buffer)
-			for _, f := range jd.(map[string]interface{})["embedding"].([]interface{}) {
-				err := binary.Write(buf, binary.LittleEndian, float32(f.(float64)))
-				if err != nil {
-					fmt.Println("binary.Write failed:", err)
-				}
-			}
-			byteArray := buf.Bytes()
-			// 将字节数组转换为Base64字符串
-			base64Str := base64.StdEncoding.EncodeToString(byteArray)
-			jsonData["data"].([]interface{})[jd_idx].(map[string]interface{})["embedding"] = base64Str
+	if resp.StatusCode != http.StatusOK {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
+		case http.StatusForbidden:
+			logger.Error(fmt.Sprintf(api.AccountForbiddenErrorMessage, c.GetString(api.EmailKey)))
 		}
-		c.AbortWithStatusJSON(resp.StatusCode, jsonData)
-		return
+		api.AbortWithUpstreamMap(c, resp.StatusCode, responseMap)
+		return nil, true
 	}
-	c.AbortWithStatusJSON(resp.StatusCode, jsonData)
 
+	// patsnap may wrap the openai response in data
+	if jsonData, ok := responseMap["data"].(map[string]interface{}); ok {
+		return jsonData, false
+	}
+	if _, ok := responseMap["data"].([]interface{}); ok {
+		return responseMap, false
+	}
+	api.AbortWithUpstreamMap(c, http.StatusBadGateway, responseMap)
+	return nil, true
 }
 
 func GetBillingSubscription(c *gin.Context) {
 	url := getPatApiUrlPrefix() + patApiCostUsage
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodGet, url, nil)
 	req.Header.Set(api.AuthorizationHeader, api.GetBearerToken(c))
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 		return
 	}
 	responseMap := make(map[string]interface{})
@@ -298,20 +401,18 @@ func GetBillingSubscription(c *gin.Context) {
 
 func GetBillingUsage(c *gin.Context) {
 	url := getPatApiUrlPrefix() + patApiCostUsage
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPatsnap, http.MethodGet, url, nil)
 	req.Header.Set(api.AuthorizationHeader, api.GetBearerToken(c))
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderPatsnap).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+		api.AbortWithUpstreamResponse(c, resp)
 		return
 	}
 	responseMap := make(map[string]interface{})
@@ -11,6 +11,10 @@ const (
 	patApiCreateCompletions     = "/v1/completions"
 	patApiCreateEmbeddings      = "/v1/embeddings"
 	patApiCostUsage             = "/common/cost/usage"
+
+	parseJsonErrorMessage              = "failed to parse json request body"
+	invalidEmbeddingsInputErrorMessage = "input must be a string, an array of strings, a token array or an array of token arrays"
+	emptyEmbeddingsErrorMessage        = "upstream returned fewer embeddings than inputs"
 )
 
 func decoded(code string) string {
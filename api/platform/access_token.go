@@ -1,6 +1,7 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -12,7 +13,7 @@ import (
 	"github.com/dhso/go-chatgpt-api/api"
 )
 
-func (userLogin *UserLogin) GetAuthorizedUrl(csrfToken string) (string, int, error) {
+func (userLogin *UserLogin) GetAuthorizedUrl(ctx context.Context, csrfToken string) (string, int, error) {
 	urlParams := url.Values{
 		"client_id":     {platformAuthClientID},
 		"audience":      {platformAuthAudience},
@@ -20,7 +21,7 @@ func (userLogin *UserLogin) GetAuthorizedUrl(csrfToken string) (string, int, err
 		"scope":         {platformAuthScope},
 		"response_type": {platformAuthResponseType},
 	}
-	req, _ := http.NewRequest(http.MethodGet, platformAuth0Url+urlParams.Encode(), nil)
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderPlatform, http.MethodGet, platformAuth0Url+urlParams.Encode(), nil)
 	req.Header.Set("Content-Type", api.ContentType)
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
@@ -41,7 +42,7 @@ func (userLogin *UserLogin) GetState(authorizedUrl string) (string, int, error)
 	return split[1], http.StatusOK, nil
 }
 
-func (userLogin *UserLogin) CheckUsername(state string, username string) (int, error) {
+func (userLogin *UserLogin) CheckUsername(ctx context.Context, state string, username string) (int, error) {
 	formParams := url.Values{
 		"state":                       {state},
 		"username":                    {username},
@@ -51,7 +52,7 @@ func (userLogin *UserLogin) CheckUsername(state string, username string) (int, e
 		"webauthn-platform-available": {"false"},
 		"action":                      {"default"},
 	}
-	req, _ := http.NewRequest(http.MethodPost, api.LoginUsernameUrl+state, strings.NewReader(formParams.Encode()))
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderPlatform, http.MethodPost, api.LoginUsernameUrl+state, strings.NewReader(formParams.Encode()))
 	req.Header.Set("Content-Type", api.ContentType)
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
@@ -67,14 +68,14 @@ func (userLogin *UserLogin) CheckUsername(state string, username string) (int, e
 	return http.StatusOK, nil
 }
 
-func (userLogin *UserLogin) CheckPassword(state string, username string, password string) (string, int, error) {
+func (userLogin *UserLogin) CheckPassword(ctx context.Context, state string, username string, password string) (string, int, error) {
 	formParams := url.Values{
 		"state":    {state},
 		"username": {username},
 		"password": {password},
 		"action":   {"default"},
 	}
-	req, _ := http.NewRequest(http.MethodPost, api.LoginPasswordUrl+state, strings.NewReader(formParams.Encode()))
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderPlatform, http.MethodPost, api.LoginPasswordUrl+state, strings.NewReader(formParams.Encode()))
 	req.Header.Set("Content-Type", api.ContentType)
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
@@ -90,14 +91,14 @@ func (userLogin *UserLogin) CheckPassword(state string, username string, passwor
 	return resp.Request.URL.Query().Get("code"), http.StatusOK, nil
 }
 
-func (userLogin *UserLogin) GetAccessToken(code string) (string, int, error) {
+func (userLogin *UserLogin) GetAccessToken(ctx context.Context, code string) (string, int, error) {
 	jsonBytes, _ := json.Marshal(GetAccessTokenRequest{
 		ClientID:    platformAuthClientID,
 		Code:        code,
 		GrantType:   platformAuthGrantType,
 		RedirectURI: platformAuthRedirectURL,
 	})
-	req, _ := http.NewRequest(http.MethodPost, getTokenUrl, strings.NewReader(string(jsonBytes)))
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderPlatform, http.MethodPost, getTokenUrl, strings.NewReader(string(jsonBytes)))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
@@ -113,3 +114,29 @@ func (userLogin *UserLogin) GetAccessToken(code string) (string, int, error) {
 	data, _ := io.ReadAll(resp.Body)
 	return string(data), http.StatusOK, nil
 }
+
+func (userLogin *UserLogin) RefreshAccessToken(ctx context.Context, refreshToken string) (GetAccessTokenResponse, int, error) {
+	var getAccessTokenResponse GetAccessTokenResponse
+	jsonBytes, _ := json.Marshal(RefreshAccessTokenRequest{
+		ClientID:     platformAuthClientID,
+		GrantType:    platformAuthRefreshGrantType,
+		RefreshToken: refreshToken,
+	})
+	req, _ := api.NewUpstreamRequest(ctx, api.ProviderPlatform, http.MethodPost, getTokenUrl, strings.NewReader(string(jsonBytes)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := userLogin.client.Do(req)
+	if err != nil {
+		return getAccessTokenResponse, http.StatusInternalServerError, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return getAccessTokenResponse, resp.StatusCode, errors.New(api.GetAccessTokenErrorMessage)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&getAccessTokenResponse); err != nil {
+		return getAccessTokenResponse, http.StatusInternalServerError, err
+	}
+	return getAccessTokenResponse, http.StatusOK, nil
+}
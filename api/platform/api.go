@@ -12,21 +12,27 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/embeddings"
 	"github.com/linweiyuan/go-logger/logger"
 )
 
 func CreateChatCompletions(c *gin.Context) {
+	forward(c, apiCreateChatCompletions)
+}
+
+// CreateCompletions uses the native legacy completions api, the response is already text_completion shaped.
+func CreateCompletions(c *gin.Context) {
+	forward(c, apiCreateCompletions)
+}
+
+func forward(c *gin.Context, url string) {
 	body, _ := io.ReadAll(c.Request.Body)
 	var request struct {
 		Stream bool `json:"stream"`
 	}
-	json.Unmarshal(body, &request)
-
-	url := c.Request.URL.Path
-	if strings.Contains(url, "/chat") {
-		url = apiCreateChatCompletions
-	} else {
-		url = apiCreateCompletions
+	if err := json.Unmarshal(body, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
 	}
 
 	resp, err := handlePost(c, url, body, request.Stream)
@@ -35,11 +41,11 @@ func CreateChatCompletions(c *gin.Context) {
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusUnauthorized {
-		logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
-		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
-		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
+		}
+		api.AbortWithUpstreamResponse(c, resp)
 		return
 	}
 
@@ -50,10 +56,6 @@ func CreateChatCompletions(c *gin.Context) {
 	}
 }
 
-func CreateCompletions(c *gin.Context) {
-	CreateChatCompletions(c)
-}
-
 func handleCompletionsResponse(c *gin.Context, resp *http.Response) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 
@@ -65,6 +67,9 @@ func handleCompletionsResponse(c *gin.Context, resp *http.Response) {
 
 		line, err := reader.ReadString('\n')
 		if err != nil {
+			if err != io.EOF {
+				api.AbortWithError(c, http.StatusBadGateway, err.Error())
+			}
 			break
 		}
 
@@ -81,17 +86,62 @@ func handleCompletionsResponse(c *gin.Context, resp *http.Response) {
 }
 
 func handlePost(c *gin.Context, url string, data []byte, stream bool) (*http.Response, error) {
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPlatform, http.MethodPost, url, bytes.NewBuffer(data))
 	req.Header.Set(api.AuthorizationHeader, api.GetAccessToken(c))
 	if stream {
 		req.Header.Set("Accept", "text/event-stream")
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.GetClient(api.ProviderPlatform).Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, api.UpstreamCause(req, err).Error())
 		return nil, err
 	}
 
 	return resp, nil
 }
+
+func CreateEmbeddings(c *gin.Context) {
+	body, _ := io.ReadAll(c.Request.Body)
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	// upstream always answers with floats, encoding_format and dimensions are applied afterwards
+	encodingFormat, _ := request["encoding_format"].(string)
+	dimensions, _ := request["dimensions"].(float64)
+	model, _ := request["model"].(string)
+	delete(request, "encoding_format")
+	if !embeddings.SupportsDimensions(model) {
+		delete(request, "dimensions")
+	}
+	body, _ = json.Marshal(request)
+
+	resp, err := handlePost(c, apiCreateEmbeddings, body, false)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+	responseMap := make(map[string]interface{})
+	json.NewDecoder(resp.Body).Decode(&responseMap)
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			logger.Error(fmt.Sprintf(api.AccountDeactivatedErrorMessage, c.GetString(api.EmailKey)))
+		}
+		api.AbortWithUpstreamMap(c, resp.StatusCode, responseMap)
+		return
+	}
+
+	data, _ := responseMap["data"].([]interface{})
+	items := make([]map[string]interface{}, 0, len(data))
+	for _, item := range data {
+		if embedding, ok := item.(map[string]interface{}); ok {
+			items = append(items, embedding)
+		}
+	}
+	embeddings.Normalize(items, encodingFormat, int(dimensions))
+	c.JSON(http.StatusOK, responseMap)
+}
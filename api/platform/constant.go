@@ -5,17 +5,21 @@ import "github.com/dhso/go-chatgpt-api/api"
 const (
 	apiCreateChatCompletions = api.PlatformApiUrlPrefix + "/v1/chat/completions"
 	apiCreateCompletions     = api.PlatformApiUrlPrefix + "/v1/completions"
+	apiCreateEmbeddings      = api.PlatformApiUrlPrefix + "/v1/embeddings"
 
-	platformAuthClientID      = "DRivsnm2Mu42T3KOpqdtwB3NYviHYzwD"
-	platformAuthAudience      = "https://api.openai.com/v1"
-	platformAuthRedirectURL   = "https://platform.openai.com/auth/callback"
-	platformAuthScope         = "openid profile email offline_access"
-	platformAuthResponseType  = "code"
-	platformAuthGrantType     = "authorization_code"
-	platformAuth0Url          = api.Auth0Url + "/authorize?"
-	getTokenUrl               = api.Auth0Url + "/oauth/token"
-	auth0Client               = "eyJuYW1lIjoiYXV0aDAtc3BhLWpzIiwidmVyc2lvbiI6IjEuMjEuMCJ9" // '{"name":"auth0-spa-js","version":"1.21.0"}'
-	auth0LogoutUrl            = api.Auth0Url + "/v2/logout?returnTo=https%3A%2F%2Fplatform.openai.com%2Floggedout&client_id=" + platformAuthClientID + "&auth0Client=" + auth0Client
-	dashboardLoginUrl         = "https://api.openai.com/dashboard/onboarding/login"
-	getSessionKeyErrorMessage = "failed to get session key"
+	platformAuthClientID            = "DRivsnm2Mu42T3KOpqdtwB3NYviHYzwD"
+	platformAuthAudience            = "https://api.openai.com/v1"
+	platformAuthRedirectURL         = "https://platform.openai.com/auth/callback"
+	platformAuthScope               = "openid profile email offline_access"
+	platformAuthResponseType        = "code"
+	platformAuthGrantType           = "authorization_code"
+	platformAuthRefreshGrantType    = "refresh_token"
+	platformAuth0Url                = api.Auth0Url + "/authorize?"
+	getTokenUrl                     = api.Auth0Url + "/oauth/token"
+	auth0Client                     = "eyJuYW1lIjoiYXV0aDAtc3BhLWpzIiwidmVyc2lvbiI6IjEuMjEuMCJ9" // '{"name":"auth0-spa-js","version":"1.21.0"}'
+	auth0LogoutUrl                  = api.Auth0Url + "/v2/logout?returnTo=https%3A%2F%2Fplatform.openai.com%2Floggedout&client_id=" + platformAuthClientID + "&auth0Client=" + auth0Client
+	dashboardLoginUrl               = "https://api.openai.com/dashboard/onboarding/login"
+	getSessionKeyErrorMessage       = "failed to get session key"
+	missingRefreshTokenErrorMessage = "login did not return a refresh token"
+	parseJsonErrorMessage           = "failed to parse json request body"
 )
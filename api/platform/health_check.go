@@ -0,0 +1,12 @@
+package platform
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/health"
+)
+
+func init() {
+	health.Register(api.ProviderPlatform, health.ExpectStatus(api.ProviderPlatform, api.PlatformApiUrlPrefix+"/v1/models", http.StatusUnauthorized))
+}
@@ -1,25 +1,28 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
 	"strings"
+	"time"
 
 	http "github.com/bogdanfinn/fhttp"
 	"github.com/gin-gonic/gin"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/session"
 )
 
 func Login(c *gin.Context) {
 	var loginInfo api.LoginInfo
 	if err := c.ShouldBindJSON(&loginInfo); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(api.ParseUserInfoErrorMessage))
+		api.AbortWithError(c, http.StatusBadRequest, api.ParseUserInfoErrorMessage)
 		return
 	}
 
 	userLogin := UserLogin{
-		client: api.NewHttpClient(),
+		client: api.NewSessionClient(api.ProviderPlatform),
 	}
 
 	// hard refresh cookies
@@ -27,9 +30,9 @@ func Login(c *gin.Context) {
 	defer resp.Body.Close()
 
 	// get authorized url
-	authorizedUrl, statusCode, err := userLogin.GetAuthorizedUrl("")
+	authorizedUrl, statusCode, err := userLogin.GetAuthorizedUrl(c.Request.Context(), "")
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, statusCode, err.Error())
 		return
 	}
 
@@ -37,44 +40,87 @@ func Login(c *gin.Context) {
 	state, _, _ := userLogin.GetState(authorizedUrl)
 
 	// check username
-	statusCode, err = userLogin.CheckUsername(state, loginInfo.Username)
+	statusCode, err = userLogin.CheckUsername(c.Request.Context(), state, loginInfo.Username)
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, statusCode, err.Error())
 		return
 	}
 
 	// check password
-	code, statusCode, err := userLogin.CheckPassword(state, loginInfo.Username, loginInfo.Password)
+	code, statusCode, err := userLogin.CheckPassword(c.Request.Context(), state, loginInfo.Username, loginInfo.Password)
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, statusCode, err.Error())
 		return
 	}
 
 	// get access token
-	accessToken, statusCode, err := userLogin.GetAccessToken(code)
+	accessToken, statusCode, err := userLogin.GetAccessToken(c.Request.Context(), code)
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, statusCode, err.Error())
 		return
 	}
 
 	// get session key
 	var getAccessTokenResponse GetAccessTokenResponse
 	json.Unmarshal([]byte(accessToken), &getAccessTokenResponse)
-	req, _ := http.NewRequest(http.MethodPost, dashboardLoginUrl, strings.NewReader("{}"))
+	req, _ := api.NewUpstreamRequest(c.Request.Context(), api.ProviderPlatform, http.MethodPost, dashboardLoginUrl, strings.NewReader("{}"))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", api.UserAgent)
 	req.Header.Set(api.AuthorizationHeader, "Bearer "+getAccessTokenResponse.AccessToken)
 	resp, err = userLogin.client.Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		c.AbortWithStatusJSON(resp.StatusCode, api.ReturnMessage(getSessionKeyErrorMessage))
+		api.AbortWithError(c, resp.StatusCode, getSessionKeyErrorMessage)
 		return
 	}
 
-	io.Copy(c.Writer, resp.Body)
+	var loginResponse map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&loginResponse); err != nil {
+		api.AbortWithError(c, http.StatusBadGateway, getSessionKeyErrorMessage)
+		return
+	}
+
+	var expiresAt time.Time
+	if getAccessTokenResponse.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(getAccessTokenResponse.ExpiresIn) * time.Second)
+	}
+	s := session.DefaultStore.Create(session.ProviderPlatform, loginInfo.Username, getAccessTokenResponse.AccessToken, getAccessTokenResponse.RefreshToken, expiresAt, refreshSession(userLogin))
+	loginResponse["sessionKey"] = s.Key
+	loginResponse["expiresAt"] = s.ExpiresAt
+
+	c.JSON(http.StatusOK, loginResponse)
+}
+
+func init() {
+	session.RegisterRefresher(session.ProviderPlatform, func(ctx context.Context, s *session.Session) error {
+		return refreshSession(UserLogin{client: api.NewSessionClient(api.ProviderPlatform)})(ctx, s)
+	})
+}
+
+func refreshSession(userLogin UserLogin) session.Refresher {
+	return func(ctx context.Context, s *session.Session) error {
+		if s.RefreshToken == "" {
+			return errors.New(missingRefreshTokenErrorMessage)
+		}
+
+		getAccessTokenResponse, _, err := userLogin.RefreshAccessToken(ctx, s.RefreshToken)
+		if err != nil {
+			return err
+		}
+
+		s.AccessToken = getAccessTokenResponse.AccessToken
+		if getAccessTokenResponse.RefreshToken != "" {
+			// refresh tokens rotate, the old one is no longer valid
+			s.RefreshToken = getAccessTokenResponse.RefreshToken
+		}
+		if getAccessTokenResponse.ExpiresIn > 0 {
+			s.ExpiresAt = time.Now().Add(time.Duration(getAccessTokenResponse.ExpiresIn) * time.Second)
+		}
+		return nil
+	}
 }
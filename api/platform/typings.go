@@ -13,6 +13,12 @@ type GetAccessTokenRequest struct {
 	RedirectURI string `json:"redirect_uri"`
 }
 
+type RefreshAccessTokenRequest struct {
+	ClientID     string `json:"client_id"`
+	GrantType    string `json:"grant_type"`
+	RefreshToken string `json:"refresh_token"`
+}
+
 type GetAccessTokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
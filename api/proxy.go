@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// Proxy forwards unknown routes to the upstream configured for their prefix, streaming both directions.
+func Proxy(c *gin.Context) {
+	prefix, upstream, ok := proxyRoute(c.Request.URL.Path)
+	if !ok {
+		AbortWithError(c, http.StatusNotFound, fmt.Sprintf(noProxyRouteErrorMessage, c.Request.URL.Path))
+		return
+	}
+
+	url := upstream + strings.TrimPrefix(c.Request.URL.Path, prefix)
+	if c.Request.URL.RawQuery != "" {
+		url += "?" + c.Request.URL.RawQuery
+	}
+
+	var body io.Reader
+	if c.Request.Body != nil && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		body = c.Request.Body
+	}
+	req, _ := NewUpstreamRequest(c.Request.Context(), ProviderProxy, c.Request.Method, url, body)
+	if body != nil {
+		req.ContentLength = c.Request.ContentLength
+	}
+	for _, name := range proxyHeaders("PROXY_REQUEST_HEADERS", defaultProxyRequestHeaders) {
+		for _, value := range c.Request.Header.Values(name) {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set(AuthorizationHeader, GetAccessToken(c))
+	resp, err := GetClient(ProviderProxy).Do(req)
+	if err != nil {
+		AbortWithError(c, http.StatusBadGateway, UpstreamCause(req, err).Error())
+		return
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		logger.Error(fmt.Sprintf(AccountDeactivatedErrorMessage, c.GetString(EmailKey)))
+	}
+
+	for _, name := range proxyHeaders("PROXY_RESPONSE_HEADERS", defaultProxyResponseHeaders) {
+		values := resp.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		c.Writer.Header().Del(name)
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+	c.Writer.WriteHeaderNow()
+
+	// flush every read so that SSE events reach the client as they arrive
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, err := c.Writer.Write(buffer[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Warn(UpstreamCause(req, err).Error())
+			}
+			return
+		}
+	}
+}
+
+// proxyRoute finds the upstream for path using the longest matching prefix of PROXY_ROUTES
+// (e.g. "/chatgpt=https://chat.openai.com,/platform=https://api.openai.com").
+func proxyRoute(path string) (string, string, bool) {
+	routes := os.Getenv("PROXY_ROUTES")
+	if routes == "" {
+		routes = defaultProxyRoutes
+	}
+
+	matched, upstream := "", ""
+	for _, route := range strings.Split(routes, ",") {
+		prefix, target, found := strings.Cut(strings.TrimSpace(route), "=")
+		prefix = strings.TrimSuffix(prefix, "/")
+		if !found || prefix == "" || len(prefix) <= len(matched) {
+			continue
+		}
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		matched = prefix
+		upstream = strings.TrimSuffix(strings.TrimSpace(target), "/")
+	}
+	return matched, upstream, matched != ""
+}
+
+func proxyHeaders(key string, defaultHeaders string) []string {
+	headers := os.Getenv(key)
+	if headers == "" {
+		headers = defaultHeaders
+	}
+
+	var names []string
+	for _, name := range strings.Split(headers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/xqdoo00o/OpenAIAuth/auth"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+type PUIDStatus struct {
+	Email       string     `json:"email"`
+	Disabled    bool       `json:"disabled"`
+	Valid       bool       `json:"valid"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	NextRefresh time.Time  `json:"next_refresh"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Failures    int        `json:"failures"`
+}
+
+type puidAccount struct {
+	username string
+	password string
+
+	mu        sync.RWMutex
+	puid      string
+	expiresAt time.Time
+	status    PUIDStatus
+	wake      chan struct{}
+}
+
+type puidAccountRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Disabled *bool  `json:"disabled"`
+}
+
+var (
+	puidAccounts   []*puidAccount
+	puidAccountsMu sync.RWMutex
+)
+
+// setupPUID keeps a PUID for every configured account, OPENAI_ACCOUNTS takes a comma separated list of email:password.
+func setupPUID() {
+	var accounts [][2]string
+	if username, password := os.Getenv("OPENAI_EMAIL"), os.Getenv("OPENAI_PASSWORD"); username != "" && password != "" {
+		accounts = append(accounts, [2]string{username, password})
+	}
+	for _, account := range strings.Split(os.Getenv("OPENAI_ACCOUNTS"), ",") {
+		username, password, ok := strings.Cut(strings.TrimSpace(account), ":")
+		if ok && username != "" && password != "" {
+			accounts = append(accounts, [2]string{username, password})
+		}
+	}
+
+	for _, account := range accounts {
+		addPUIDAccount(account[0], account[1])
+	}
+}
+
+func addPUIDAccount(username string, password string) (*puidAccount, bool) {
+	puidAccountsMu.Lock()
+	defer puidAccountsMu.Unlock()
+
+	for _, a := range puidAccounts {
+		if a.username == username {
+			return a, false
+		}
+	}
+
+	a := &puidAccount{
+		username: username,
+		password: password,
+		status:   PUIDStatus{Email: username},
+		wake:     make(chan struct{}, 1),
+	}
+	puidAccounts = append(puidAccounts, a)
+	go a.refreshLoop()
+	return a, true
+}
+
+func getPUIDAccounts() []*puidAccount {
+	puidAccountsMu.RLock()
+	defer puidAccountsMu.RUnlock()
+
+	return append([]*puidAccount(nil), puidAccounts...)
+}
+
+func findPUIDAccount(username string) *puidAccount {
+	for _, a := range getPUIDAccounts() {
+		if a.username == username {
+			return a
+		}
+	}
+	return nil
+}
+
+// GetPUID returns the PUID of the first enabled account that currently has a valid one.
+func GetPUID() string {
+	for _, a := range getPUIDAccounts() {
+		if puid := a.get(); puid != "" {
+			return puid
+		}
+	}
+	return ""
+}
+
+func GetPUIDStatus(c *gin.Context) {
+	accounts := getPUIDAccounts()
+	statuses := make([]PUIDStatus, 0, len(accounts))
+	for _, a := range accounts {
+		statuses = append(statuses, a.getStatus())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"puid":     GetPUID() != "",
+		"accounts": statuses,
+	})
+}
+
+// AddPUIDAccount starts keeping a PUID for one more account.
+func AddPUIDAccount(c *gin.Context) {
+	var request puidAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" || request.Password == "" {
+		AbortWithError(c, http.StatusBadRequest, ParseUserInfoErrorMessage)
+		return
+	}
+
+	a, ok := addPUIDAccount(request.Email, request.Password)
+	if !ok {
+		AbortWithParamError(c, http.StatusConflict, fmt.Sprintf(accountExistsErrorMessage, request.Email), "email")
+		return
+	}
+
+	c.JSON(http.StatusOK, a.getStatus())
+}
+
+// UpdatePUIDAccount enables or disables an account, disabled accounts are neither refreshed nor used.
+func UpdatePUIDAccount(c *gin.Context) {
+	a := findPUIDAccount(c.Param("email"))
+	if a == nil {
+		AbortWithError(c, http.StatusNotFound, fmt.Sprintf(accountNotFoundErrorMessage, c.Param("email")))
+		return
+	}
+
+	var request puidAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Disabled == nil {
+		AbortWithParamError(c, http.StatusBadRequest, fmt.Sprintf(missingParamErrorMessage, "disabled"), "disabled")
+		return
+	}
+
+	a.mu.Lock()
+	a.status.Disabled = *request.Disabled
+	if request.Password != "" {
+		a.password = request.Password
+	}
+	a.mu.Unlock()
+	a.refresh()
+
+	c.JSON(http.StatusOK, a.getStatus())
+}
+
+// RefreshPUIDAccount fetches a new PUID right away instead of waiting for the schedule.
+func RefreshPUIDAccount(c *gin.Context) {
+	a := findPUIDAccount(c.Param("email"))
+	if a == nil {
+		AbortWithError(c, http.StatusNotFound, fmt.Sprintf(accountNotFoundErrorMessage, c.Param("email")))
+		return
+	}
+
+	a.refresh()
+	c.JSON(http.StatusOK, a.getStatus())
+}
+
+func (a *puidAccount) get() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.status.Disabled || a.puid == "" || time.Now().After(a.expiresAt) {
+		return ""
+	}
+	return a.puid
+}
+
+// refresh wakes the refresh loop up, it never blocks.
+func (a *puidAccount) refresh() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *puidAccount) getStatus() PUIDStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status := a.status
+	status.Valid = a.puid != "" && time.Now().Before(a.expiresAt)
+	return status
+}
+
+func (a *puidAccount) refreshLoop() {
+	for {
+		a.mu.RLock()
+		disabled := a.status.Disabled
+		a.mu.RUnlock()
+		if disabled {
+			<-a.wake
+			continue
+		}
+
+		puid, expiresAt, err := a.fetch()
+		now := time.Now()
+
+		a.mu.Lock()
+		var wait time.Duration
+		if err != nil {
+			a.status.Failures++
+			a.status.LastFailure = &now
+			a.status.LastError = err.Error()
+			wait = puidBackoff(a.status.Failures)
+			logger.Warn(fmt.Sprintf(refreshPuidErrorMessage, a.username, err.Error(), wait))
+		} else {
+			a.puid = puid
+			a.expiresAt = expiresAt
+			a.status.Failures = 0
+			a.status.LastSuccess = &now
+			a.status.ExpiresAt = &expiresAt
+			wait = max(time.Until(expiresAt)-puidRefreshBefore, puidMinBackoff)
+		}
+		a.status.NextRefresh = now.Add(wait)
+		a.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-a.wake:
+			timer.Stop()
+		}
+	}
+}
+
+func (a *puidAccount) fetch() (string, time.Time, error) {
+	a.mu.RLock()
+	password := a.password
+	a.mu.RUnlock()
+	authenticator := auth.NewAuthenticator(a.username, password, GetClientConfig(ProviderChatGPT).Proxy)
+	if err := authenticator.Begin(); err != nil {
+		return "", time.Time{}, errors.New(err.Details)
+	}
+	accessToken := authenticator.GetAccessToken()
+	if accessToken == "" {
+		return "", time.Time{}, errors.New(GetAccessTokenErrorMessage)
+	}
+
+	req, _ := NewUpstreamRequest(context.Background(), ProviderChatGPT, http.MethodGet, ChatGPTApiUrlPrefix+"/backend-api/models?history_and_training_disabled=false", nil)
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set(AuthorizationHeader, "Bearer "+accessToken)
+	resp, err := GetClient(ProviderChatGPT).Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, errors.New(resp.Status)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name != "_puid" {
+			continue
+		}
+
+		expiresAt := cookie.Expires
+		if cookie.MaxAge > 0 {
+			expiresAt = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		if expiresAt.IsZero() {
+			expiresAt = time.Now().Add(defaultPuidLifetime)
+		}
+		return cookie.Value, expiresAt, nil
+	}
+
+	return "", time.Time{}, errors.New(puidCookieNotFoundErrorMessage)
+}
+
+// puidBackoff doubles the wait with every consecutive failure and adds some jitter.
+func puidBackoff(failures int) time.Duration {
+	backoff := puidMaxBackoff
+	if failures < 16 {
+		backoff = min(puidMinBackoff<<(failures-1), puidMaxBackoff)
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff/10)+1))
+}
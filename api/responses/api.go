@@ -0,0 +1,122 @@
+package responses
+
+import (
+	"encoding/json"
+	"fmt"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/backend"
+)
+
+func CreateResponse(c *gin.Context) {
+	var request CreateResponseRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		api.AbortWithError(c, http.StatusBadRequest, parseJsonErrorMessage)
+		return
+	}
+
+	if request.Model == "" {
+		api.AbortWithParamError(c, http.StatusBadRequest, emptyModelErrorMessage, "model")
+		return
+	}
+
+	messages, err := parseInput(request.Input)
+	if err != nil {
+		api.AbortWithParamError(c, http.StatusBadRequest, err.Error(), "input")
+		return
+	}
+
+	var history []backend.ChatMessage
+	if request.PreviousResponseID != "" {
+		previous, ok := responseStore.get(request.PreviousResponseID)
+		if !ok {
+			api.AbortWithParamError(c, http.StatusNotFound, fmt.Sprintf(responseNotFoundErrorMessage, request.PreviousResponseID), "previous_response_id")
+			return
+		}
+		history = previous.messages
+	}
+	conversation := append(append([]backend.ChatMessage{}, history...), messages...)
+
+	chatRequest := convertRequest(request, conversation)
+	response := newResponse(request)
+	if request.Stream {
+		streamResponse(c, chatRequest, &response)
+	} else {
+		completion, err := backend.Complete(c, chatRequest)
+		if err != nil {
+			backend.AbortWithError(c, err)
+			return
+		}
+
+		completeResponse(&response, completion)
+		c.JSON(http.StatusOK, response)
+	}
+
+	if response.Store && response.Status != statusFailed {
+		responseStore.put(storedResponse{
+			response: response,
+			messages: append(conversation, outputMessages(response.Output)...),
+		})
+	}
+}
+
+func completeResponse(response *Response, completion *backend.ChatCompletion) {
+	finishReason := ""
+	if len(completion.Choices) != 0 && completion.Choices[0].Message != nil {
+		message := completion.Choices[0].Message
+		finishReason = completion.Choices[0].FinishReason
+		if text := message.Text(); text != "" {
+			response.Output = append(response.Output, newMessageItem(text, statusCompleted))
+		}
+		for _, toolCall := range message.ToolCalls {
+			response.Output = append(response.Output, newFunctionCallItem(toolCall, statusCompleted))
+		}
+	}
+
+	finish(response, finishReason, completion.Usage)
+}
+
+func finish(response *Response, finishReason string, usage *backend.Usage) {
+	response.Status = statusCompleted
+	if finishReason == "length" {
+		response.Status = statusIncomplete
+		response.IncompleteDetails = &IncompleteDetails{Reason: "max_output_tokens"}
+	} else if finishReason == "content_filter" {
+		response.Status = statusIncomplete
+		response.IncompleteDetails = &IncompleteDetails{Reason: "content_filter"}
+	}
+	response.Usage = convertUsage(usage)
+}
+
+func GetResponse(c *gin.Context) {
+	id := c.Param("id")
+	item, ok := responseStore.get(id)
+	if !ok {
+		api.AbortWithError(c, http.StatusNotFound, fmt.Sprintf(responseNotFoundErrorMessage, id))
+		return
+	}
+
+	c.JSON(http.StatusOK, item.response)
+}
+
+func DeleteResponse(c *gin.Context) {
+	id := c.Param("id")
+	if !responseStore.delete(id) {
+		api.AbortWithError(c, http.StatusNotFound, fmt.Sprintf(responseNotFoundErrorMessage, id))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "response.deleted",
+		"deleted": true,
+	})
+}
+
+func marshal(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
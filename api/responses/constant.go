@@ -0,0 +1,16 @@
+package responses
+
+const (
+	defaultStoreSize = 1000
+
+	statusCompleted  = "completed"
+	statusIncomplete = "incomplete"
+	statusInProgress = "in_progress"
+	statusFailed     = "failed"
+
+	parseJsonErrorMessage          = "failed to parse json request body"
+	invalidInputErrorMessage       = "input must be a string or an array of input items"
+	emptyModelErrorMessage         = "model is required"
+	responseNotFoundErrorMessage   = "response with id '%s' not found"
+	unsupportedContentErrorMessage = "unsupported input content type: %s"
+)
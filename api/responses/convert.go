@@ -0,0 +1,284 @@
+package responses
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+)
+
+func parseInput(input json.RawMessage) ([]backend.ChatMessage, error) {
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return []backend.ChatMessage{{Role: "user", Content: text}}, nil
+	}
+
+	var items []InputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, errors.New(invalidInputErrorMessage)
+	}
+
+	var messages []backend.ChatMessage
+	for _, item := range items {
+		switch item.Type {
+		case "function_call":
+			toolCall := backend.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: backend.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			// consecutive calls belong to the same assistant turn
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" && len(messages[last].ToolCalls) != 0 {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, toolCall)
+			} else {
+				messages = append(messages, backend.ChatMessage{Role: "assistant", ToolCalls: []backend.ToolCall{toolCall}})
+			}
+		case "function_call_output":
+			output, ok := item.Output.(string)
+			if !ok {
+				data, _ := json.Marshal(item.Output)
+				output = string(data)
+			}
+			messages = append(messages, backend.ChatMessage{Role: "tool", Content: output, ToolCallID: item.CallID})
+		case "", "message":
+			content, err := convertContent(item.Content)
+			if err != nil {
+				return nil, err
+			}
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			messages = append(messages, backend.ChatMessage{Role: role, Content: content})
+		case "reasoning", "item_reference":
+			continue
+		default:
+			return nil, fmt.Errorf(unsupportedContentErrorMessage, item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func convertContent(raw json.RawMessage) (any, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var contents []InputContent
+	if err := json.Unmarshal(raw, &contents); err != nil {
+		return nil, errors.New(invalidInputErrorMessage)
+	}
+
+	var parts []backend.ContentPart
+	hasImage := false
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text", "text":
+			parts = append(parts, backend.ContentPart{Type: "text", Text: content.Text})
+		case "input_image":
+			hasImage = true
+			parts = append(parts, backend.ContentPart{
+				Type:     "image_url",
+				ImageURL: &backend.ImageURL{URL: content.ImageURL, Detail: content.Detail},
+			})
+		case "refusal":
+			continue
+		default:
+			return nil, fmt.Errorf(unsupportedContentErrorMessage, content.Type)
+		}
+	}
+
+	if !hasImage {
+		var texts []string
+		for _, part := range parts {
+			texts = append(texts, part.Text)
+		}
+		return strings.Join(texts, ""), nil
+	}
+	return parts, nil
+}
+
+func convertRequest(request CreateResponseRequest, messages []backend.ChatMessage) backend.ChatCompletionRequest {
+	chatRequest := backend.ChatCompletionRequest{
+		Model:       request.Model,
+		Stream:      request.Stream,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		MaxTokens:   request.MaxOutputTokens,
+		User:        request.User,
+	}
+
+	if request.Instructions != "" {
+		chatRequest.Messages = append(chatRequest.Messages, backend.ChatMessage{Role: "system", Content: request.Instructions})
+	}
+	chatRequest.Messages = append(chatRequest.Messages, messages...)
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			continue
+		}
+		chatRequest.Tools = append(chatRequest.Tools, backend.Tool{
+			Type: "function",
+			Function: backend.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	switch toolChoice := request.ToolChoice.(type) {
+	case string:
+		chatRequest.ToolChoice = toolChoice
+	case map[string]any:
+		if toolChoice["type"] == "function" {
+			chatRequest.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": toolChoice["name"]},
+			}
+		}
+	}
+	if len(chatRequest.Tools) == 0 {
+		chatRequest.ToolChoice = nil
+	}
+
+	if request.Text != nil && request.Text.Format != nil {
+		switch format := request.Text.Format; format.Type {
+		case "json_object":
+			chatRequest.ResponseFormat = map[string]any{"type": "json_object"}
+		case "json_schema":
+			chatRequest.ResponseFormat = map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   format.Name,
+					"schema": format.Schema,
+					"strict": format.Strict,
+				},
+			}
+		}
+	}
+
+	return chatRequest
+}
+
+func newResponse(request CreateResponseRequest) Response {
+	response := Response{
+		ID:                newID("resp_"),
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Status:            statusInProgress,
+		Model:             request.Model,
+		Output:            []OutputItem{},
+		ParallelToolCalls: request.ParallelToolCalls == nil || *request.ParallelToolCalls,
+		Store:             request.Store == nil || *request.Store,
+		Temperature:       request.Temperature,
+		TopP:              request.TopP,
+		Text:              request.Text,
+		ToolChoice:        request.ToolChoice,
+		Tools:             request.Tools,
+		Metadata:          request.Metadata,
+	}
+
+	if response.ToolChoice == nil {
+		response.ToolChoice = "auto"
+	}
+	if response.Tools == nil {
+		response.Tools = []Tool{}
+	}
+	if response.Metadata == nil {
+		response.Metadata = map[string]any{}
+	}
+	if request.Instructions != "" {
+		response.Instructions = &request.Instructions
+	}
+	if request.MaxOutputTokens != 0 {
+		response.MaxOutputTokens = &request.MaxOutputTokens
+	}
+	if request.PreviousResponseID != "" {
+		response.PreviousResponseID = &request.PreviousResponseID
+	}
+	if request.User != "" {
+		response.User = &request.User
+	}
+	return response
+}
+
+func newMessageItem(text string, status string) OutputItem {
+	return OutputItem{
+		Type:    "message",
+		ID:      newID("msg_"),
+		Status:  status,
+		Role:    "assistant",
+		Content: []OutputContent{{Type: "output_text", Text: text, Annotations: []any{}}},
+	}
+}
+
+func newFunctionCallItem(toolCall backend.ToolCall, status string) OutputItem {
+	callID := toolCall.ID
+	if callID == "" {
+		callID = newID("call_")
+	}
+	arguments := toolCall.Function.Arguments
+	return OutputItem{
+		Type:      "function_call",
+		ID:        newID("fc_"),
+		Status:    status,
+		CallID:    callID,
+		Name:      toolCall.Function.Name,
+		Arguments: &arguments,
+	}
+}
+
+// outputMessages turns the output of a response into chat messages for the next turn of the chain.
+func outputMessages(output []OutputItem) []backend.ChatMessage {
+	var messages []backend.ChatMessage
+	assistant := backend.ChatMessage{Role: "assistant"}
+	text := ""
+	for _, item := range output {
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				text += content.Text
+			}
+		case "function_call":
+			arguments := ""
+			if item.Arguments != nil {
+				arguments = *item.Arguments
+			}
+			assistant.ToolCalls = append(assistant.ToolCalls, backend.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: backend.FunctionCall{Name: item.Name, Arguments: arguments},
+			})
+		}
+	}
+	if text != "" {
+		assistant.Content = text
+	}
+	if text != "" || len(assistant.ToolCalls) != 0 {
+		messages = append(messages, assistant)
+	}
+	return messages
+}
+
+func convertUsage(usage *backend.Usage) *Usage {
+	if usage == nil {
+		return &Usage{}
+	}
+
+	return &Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+}
+
+func newID(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
@@ -0,0 +1,78 @@
+package responses
+
+import (
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+)
+
+// storedResponse keeps everything needed to continue a conversation with previous_response_id.
+// Instructions are not part of messages because they do not carry over to the next response.
+type storedResponse struct {
+	response Response
+	messages []backend.ChatMessage
+}
+
+type store struct {
+	mu      sync.Mutex
+	items   map[string]storedResponse
+	order   []string
+	maxSize int
+}
+
+var responseStore = newStore()
+
+func newStore() *store {
+	maxSize, err := strconv.Atoi(os.Getenv("RESPONSES_STORE_SIZE"))
+	if err != nil || maxSize <= 0 {
+		maxSize = defaultStoreSize
+	}
+
+	return &store{
+		items:   map[string]storedResponse{},
+		maxSize: maxSize,
+	}
+}
+
+func (s *store) get(id string) (storedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	return item, ok
+}
+
+func (s *store) put(item storedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[item.response.ID]; !ok {
+		s.order = append(s.order, item.response.ID)
+	}
+	s.items[item.response.ID] = item
+
+	for len(s.order) > s.maxSize {
+		delete(s.items, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *store) delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return false
+	}
+
+	delete(s.items, id)
+	for i, item := range s.order {
+		if item == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package responses
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api/backend"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+// eventWriter emits typed response events, every event carries an increasing sequence_number.
+type eventWriter struct {
+	w        gin.ResponseWriter
+	sequence int
+	started  bool
+}
+
+func (e *eventWriter) emit(eventType string, payload map[string]any) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", "text/event-stream")
+		e.w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	payload["type"] = eventType
+	payload["sequence_number"] = e.sequence
+	e.sequence++
+	e.w.Write([]byte("event: " + eventType + "\ndata: " + marshal(payload) + "\n\n"))
+	e.w.Flush()
+}
+
+func streamResponse(c *gin.Context, chatRequest backend.ChatCompletionRequest, response *Response) {
+	chatRequest.StreamOptions = &backend.StreamOptions{IncludeUsage: true}
+
+	// backend.Stream swaps c.Writer while the backend runs, keep the client writer
+	events := &eventWriter{w: c.Writer}
+
+	messageIndex := -1
+	text := ""
+	// parallel calls may interleave their deltas, so every call keeps its own output item until the end
+	callOutputs := map[int]int{}
+	var openCalls []int
+	var toolCalls []backend.ToolCall
+	finishReason := ""
+	var usage *backend.Usage
+
+	start := func() {
+		if events.started {
+			return
+		}
+		events.emit("response.created", map[string]any{"response": *response})
+		events.emit("response.in_progress", map[string]any{"response": *response})
+	}
+	closeMessage := func() {
+		if messageIndex < 0 {
+			return
+		}
+		item := response.Output[messageIndex]
+		item.Status = statusCompleted
+		item.Content[0].Text = text
+		response.Output[messageIndex] = item
+		events.emit("response.output_text.done", map[string]any{"item_id": item.ID, "output_index": messageIndex, "content_index": 0, "text": text})
+		events.emit("response.content_part.done", map[string]any{"item_id": item.ID, "output_index": messageIndex, "content_index": 0, "part": item.Content[0]})
+		events.emit("response.output_item.done", map[string]any{"output_index": messageIndex, "item": item})
+		messageIndex = -1
+	}
+	closeCalls := func() {
+		for _, outputIndex := range openCalls {
+			item := response.Output[outputIndex]
+			item.Status = statusCompleted
+			events.emit("response.function_call_arguments.done", map[string]any{"item_id": item.ID, "output_index": outputIndex, "arguments": *item.Arguments})
+			events.emit("response.output_item.done", map[string]any{"output_index": outputIndex, "item": item})
+			response.Output[outputIndex] = item
+		}
+		openCalls = nil
+	}
+
+	err := backend.Stream(c, chatRequest, func(chunk backend.ChatCompletion) {
+		start()
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			if choice.Delta == nil {
+				continue
+			}
+
+			if delta := choice.Delta.Text(); delta != "" {
+				if messageIndex < 0 {
+					closeCalls()
+					messageIndex = len(response.Output)
+					text = ""
+					item := newMessageItem("", statusInProgress)
+					response.Output = append(response.Output, item)
+					events.emit("response.output_item.added", map[string]any{"output_index": messageIndex, "item": item})
+					events.emit("response.content_part.added", map[string]any{"item_id": item.ID, "output_index": messageIndex, "content_index": 0, "part": item.Content[0]})
+				}
+				text += delta
+				events.emit("response.output_text.delta", map[string]any{"item_id": response.Output[messageIndex].ID, "output_index": messageIndex, "content_index": 0, "delta": delta})
+			}
+
+			for i, delta := range choice.Delta.ToolCalls {
+				index := i
+				if delta.Index != nil {
+					index = *delta.Index
+				}
+				// deltas replayed from a non-streamed completion carry no index, merge them by position too
+				delta.Index = &index
+				toolCalls = backend.MergeToolCalls(toolCalls, []backend.ToolCall{delta})
+				outputIndex, ok := callOutputs[index]
+				if !ok {
+					// a new call starts, the message before it is complete
+					closeMessage()
+					outputIndex = len(response.Output)
+					callOutputs[index] = outputIndex
+					openCalls = append(openCalls, outputIndex)
+					call := toolCalls[index]
+					call.Function.Arguments = ""
+					item := newFunctionCallItem(call, statusInProgress)
+					response.Output = append(response.Output, item)
+					events.emit("response.output_item.added", map[string]any{"output_index": outputIndex, "item": item})
+				}
+				if delta.Function.Arguments != "" {
+					item := response.Output[outputIndex]
+					arguments := *item.Arguments + delta.Function.Arguments
+					item.Arguments = &arguments
+					response.Output[outputIndex] = item
+					events.emit("response.function_call_arguments.delta", map[string]any{"item_id": item.ID, "output_index": outputIndex, "delta": delta.Function.Arguments})
+				}
+			}
+		}
+	})
+	if err != nil {
+		if !events.started {
+			response.Status = statusFailed
+			backend.AbortWithError(c, err)
+			return
+		}
+
+		_, e := backend.ToError(err)
+		logger.Warn(e.Message)
+		response.Status = statusFailed
+		response.Error = map[string]any{"code": e.Type, "message": e.Message}
+		events.emit("response.failed", map[string]any{"response": *response})
+		return
+	}
+
+	start()
+	closeMessage()
+	closeCalls()
+	finish(response, finishReason, usage)
+	if response.Status == statusIncomplete {
+		events.emit("response.incomplete", map[string]any{"response": *response})
+	} else {
+		events.emit("response.completed", map[string]any{"response": *response})
+	}
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+// Logout forgets the session the request was authorized with.
+func Logout(c *gin.Context) {
+	key := c.GetString(KeyContextKey)
+	if key == "" {
+		api.AbortWithError(c, http.StatusBadRequest, noSessionErrorMessage)
+		return
+	}
+
+	DefaultStore.Delete(key)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+type importRequest struct {
+	Provider     string `json:"provider"`
+	Email        string `json:"email"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type updateRequest struct {
+	Disabled *bool `json:"disabled"`
+}
+
+func ListSessions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": DefaultStore.List(),
+	})
+}
+
+// ImportSession hands out a session key for an access token obtained outside of the gateway.
+// Like every session it lives in memory only, imported keys are gone after a restart.
+func ImportSession(c *gin.Context) {
+	var request importRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.AccessToken == "" {
+		api.AbortWithParamError(c, http.StatusBadRequest, fmt.Sprintf(missingParamErrorMessage, "access_token"), "access_token")
+		return
+	}
+	if request.Provider != ProviderPlatform {
+		request.Provider = ProviderChatGPT
+	}
+
+	c.JSON(http.StatusOK, DefaultStore.Import(request.Provider, request.Email, strings.TrimPrefix(request.AccessToken, "Bearer "), request.RefreshToken))
+}
+
+func UpdateSession(c *gin.Context) {
+	var request updateRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Disabled == nil {
+		api.AbortWithParamError(c, http.StatusBadRequest, fmt.Sprintf(missingParamErrorMessage, "disabled"), "disabled")
+		return
+	}
+
+	s, ok := DefaultStore.SetDisabled(c.Param("key"), *request.Disabled)
+	if !ok {
+		api.AbortWithError(c, http.StatusNotFound, sessionNotFoundErrorMessage)
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+func DeleteSession(c *gin.Context) {
+	if !DefaultStore.Delete(c.Param("key")) {
+		api.AbortWithError(c, http.StatusNotFound, sessionNotFoundErrorMessage)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+func RefreshSession(c *gin.Context) {
+	s, err := DefaultStore.Refresh(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		status := http.StatusBadGateway
+		switch err.Error() {
+		case sessionNotFoundErrorMessage:
+			status = http.StatusNotFound
+		case noRefresherErrorMessage:
+			status = http.StatusBadRequest
+		}
+		api.AbortWithError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
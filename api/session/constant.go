@@ -0,0 +1,23 @@
+package session
+
+import "time"
+
+const (
+	KeyPrefix     = "gcs-"
+	KeyContextKey = "sessionKey"
+
+	ProviderChatGPT  = "chatgpt"
+	ProviderPlatform = "platform"
+
+	defaultRefreshBefore = 10 * time.Minute
+	defaultIdleTimeout   = 7 * 24 * time.Hour
+	refreshInterval      = time.Minute
+	// when the token carries no expiry, refresh it on this schedule instead
+	defaultTokenLifetime = time.Hour
+
+	refreshSessionErrorMessage  = "failed to refresh %s session of %s: %s"
+	noSessionErrorMessage       = "the request was not authorized with a session key"
+	sessionNotFoundErrorMessage = "session not found"
+	noRefresherErrorMessage     = "this session can not be refreshed"
+	missingParamErrorMessage    = "missing required parameter: '%s'"
+)
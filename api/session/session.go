@@ -0,0 +1,302 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linweiyuan/go-logger/logger"
+
+	"github.com/dhso/go-chatgpt-api/api/jwt"
+)
+
+// Refresher renews the tokens of a session in place, leaving ExpiresAt zero derives it from the new access token.
+type Refresher func(ctx context.Context, s *Session) error
+
+// Session is a login result kept on the server, clients only ever see its opaque key.
+type Session struct {
+	Key          string    `json:"key"`
+	Provider     string    `json:"provider"`
+	Email        string    `json:"email"`
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	RefreshedAt  time.Time `json:"refreshed_at,omitempty"`
+	LastUsedAt   time.Time `json:"last_used_at"`
+	Disabled     bool      `json:"disabled"`
+}
+
+type entry struct {
+	mu        sync.Mutex
+	session   Session
+	refresher Refresher
+}
+
+type Store struct {
+	mu            sync.RWMutex
+	entries       map[string]*entry
+	refreshBefore time.Duration
+	idleTimeout   time.Duration
+	once          sync.Once
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+var (
+	refreshers   = map[string]Refresher{}
+	refreshersMu sync.RWMutex
+)
+
+// RegisterRefresher lets sessions imported through the admin api be refreshed like the ones created by a login.
+func RegisterRefresher(provider string, refresher Refresher) {
+	refreshersMu.Lock()
+	defer refreshersMu.Unlock()
+
+	refreshers[provider] = refresher
+}
+
+func getRefresher(provider string) Refresher {
+	refreshersMu.RLock()
+	defer refreshersMu.RUnlock()
+
+	return refreshers[provider]
+}
+
+var DefaultStore = NewStore(durationEnv("SESSION_REFRESH_BEFORE", defaultRefreshBefore), durationEnv("SESSION_IDLE_TIMEOUT", defaultIdleTimeout))
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// NewStore keeps tokens fresh refreshBefore their expiry and forgets sessions unused for idleTimeout.
+func NewStore(refreshBefore time.Duration, idleTimeout time.Duration) *Store {
+	return &Store{
+		entries:       map[string]*entry{},
+		refreshBefore: refreshBefore,
+		idleTimeout:   idleTimeout,
+		stop:          make(chan struct{}),
+	}
+}
+
+// Stop ends the background refresh, the sessions are still served but no longer refreshed ahead of time.
+func (s *Store) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
+
+// Create stores a login result and returns it with a new session key.
+func (s *Store) Create(provider string, email string, accessToken string, refreshToken string, expiresAt time.Time, refresher Refresher) Session {
+	if expiresAt.IsZero() {
+		expiresAt = TokenExpiry(accessToken)
+	}
+
+	now := time.Now()
+	e := &entry{
+		session: Session{
+			Key:          newKey(),
+			Provider:     provider,
+			Email:        email,
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresAt:    expiresAt,
+			CreatedAt:    now,
+			LastUsedAt:   now,
+		},
+		refresher: refresher,
+	}
+
+	s.mu.Lock()
+	s.entries[e.session.Key] = e
+	s.mu.Unlock()
+
+	s.once.Do(func() {
+		go s.refreshLoop()
+	})
+
+	return e.session
+}
+
+// Import stores tokens obtained elsewhere, they are refreshed with the refresher registered for the provider.
+func (s *Store) Import(provider string, email string, accessToken string, refreshToken string) Session {
+	var refresher Refresher
+	if refreshToken != "" {
+		refresher = getRefresher(provider)
+	}
+	return s.Create(provider, email, accessToken, refreshToken, time.Time{}, refresher)
+}
+
+// Get resolves a session key, refreshing its access token first when it is about to expire.
+func (s *Store) Get(ctx context.Context, key string) (Session, bool) {
+	e, ok := s.get(key)
+	if !ok {
+		return Session{}, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session.Disabled {
+		return Session{}, false
+	}
+
+	e.session.LastUsedAt = time.Now()
+	s.refresh(ctx, e, false)
+	if time.Now().After(e.session.ExpiresAt) {
+		s.Delete(key)
+		return Session{}, false
+	}
+
+	return e.session, true
+}
+
+// SetDisabled keeps a session but stops it from authorizing requests.
+func (s *Store) SetDisabled(key string, disabled bool) (Session, bool) {
+	e, ok := s.get(key)
+	if !ok {
+		return Session{}, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.session.Disabled = disabled
+	return e.session, true
+}
+
+// Refresh renews the tokens of a session right away, whatever their expiry.
+func (s *Store) Refresh(ctx context.Context, key string) (Session, error) {
+	e, ok := s.get(key)
+	if !ok {
+		return Session{}, errors.New(sessionNotFoundErrorMessage)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.refresher == nil {
+		return e.session, errors.New(noRefresherErrorMessage)
+	}
+	if err := s.refresh(ctx, e, true); err != nil {
+		return e.session, err
+	}
+	return e.session, nil
+}
+
+func (s *Store) get(key string) (*entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+func (s *Store) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.entries[key]
+	delete(s.entries, key)
+	return ok
+}
+
+func (s *Store) List() []Session {
+	s.mu.RLock()
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.mu.RUnlock()
+
+	sessions := make([]Session, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		sessions = append(sessions, e.session)
+		e.mu.Unlock()
+	}
+	return sessions
+}
+
+// refresh must be called with e.mu held.
+func (s *Store) refresh(ctx context.Context, e *entry, force bool) error {
+	if e.refresher == nil || (!force && time.Until(e.session.ExpiresAt) > s.refreshBefore) {
+		return nil
+	}
+
+	updated := e.session
+	updated.ExpiresAt = time.Time{}
+	if err := e.refresher(ctx, &updated); err != nil {
+		logger.Warn(fmt.Sprintf(refreshSessionErrorMessage, e.session.Provider, e.session.Email, err.Error()))
+		return err
+	}
+
+	if updated.ExpiresAt.IsZero() {
+		updated.ExpiresAt = TokenExpiry(updated.AccessToken)
+	}
+	updated.RefreshedAt = time.Now()
+	e.session = updated
+	return nil
+}
+
+func (s *Store) refreshLoop() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.RLock()
+		entries := make([]*entry, 0, len(s.entries))
+		for _, e := range s.entries {
+			entries = append(entries, e)
+		}
+		s.mu.RUnlock()
+
+		for _, e := range entries {
+			e.mu.Lock()
+			if time.Since(e.session.LastUsedAt) > s.idleTimeout {
+				s.Delete(e.session.Key)
+			} else {
+				s.refresh(context.Background(), e, false)
+				if time.Now().After(e.session.ExpiresAt) {
+					s.Delete(e.session.Key)
+				}
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+func newKey() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return KeyPrefix + hex.EncodeToString(buf)
+}
+
+// TokenExpiry reads the exp claim of a jwt, tokens without one are assumed to live for an hour.
+func TokenExpiry(token string) time.Time {
+	if t, err := jwt.Parse(strings.TrimPrefix(token, "Bearer ")); err == nil && t.Claims.ExpiresAt > 0 {
+		return time.Unix(t.Claims.ExpiresAt, 0)
+	}
+
+	return time.Now().Add(defaultTokenLifetime)
+}
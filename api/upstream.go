@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/fhttp/httptrace"
+	tls_client "github.com/bogdanfinn/tls-client"
+)
+
+// Timeouts bound the phases of an upstream request, zero disables a phase.
+type Timeouts struct {
+	// until a connection is established, reused connections pass at once
+	Connect time.Duration
+	// until the response headers start to arrive
+	FirstByte time.Duration
+	// for the whole request, reading the body included
+	Total time.Duration
+}
+
+// GetTimeouts takes the timeouts of the provider's client config, then <PROVIDER>_CONNECT_TIMEOUT,
+// <PROVIDER>_FIRST_BYTE_TIMEOUT and <PROVIDER>_TOTAL_TIMEOUT, then the UPSTREAM_ ones and then the defaults.
+func GetTimeouts(provider string) Timeouts {
+	return GetClientConfig(provider).timeouts(Timeouts{
+		Connect:   timeoutEnv(provider, "CONNECT_TIMEOUT", defaultConnectTimeout),
+		FirstByte: timeoutEnv(provider, "FIRST_BYTE_TIMEOUT", defaultFirstByteTimeout),
+		Total:     timeoutEnv(provider, "TOTAL_TIMEOUT", defaultTotalTimeout),
+	})
+}
+
+func timeoutEnv(provider string, name string, fallback time.Duration) time.Duration {
+	for _, key := range []string{strings.ToUpper(provider) + "_" + name, "UPSTREAM_" + name} {
+		if value := os.Getenv(key); value != "" {
+			if timeout, err := time.ParseDuration(value); err == nil && timeout >= 0 {
+				return timeout
+			}
+		}
+	}
+	return fallback
+}
+
+// NewUpstreamRequest ties an outbound request to ctx, usually the incoming request's, so that a client going away
+// cancels the upstream call too, and applies the timeouts of provider on top.
+func NewUpstreamRequest(ctx context.Context, provider string, method string, url string, body io.Reader) (*http.Request, error) {
+	return newRequestWithTimeouts(ctx, GetTimeouts(provider), method, url, body)
+}
+
+func newRequestWithTimeouts(ctx context.Context, timeouts Timeouts, method string, url string, body io.Reader) (*http.Request, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	connectTimer := phaseTimer(cancel, "connect", timeouts.Connect)
+	firstByteTimer := phaseTimer(cancel, "first byte", timeouts.FirstByte)
+	totalTimer := phaseTimer(cancel, "total", timeouts.Total)
+	context.AfterFunc(ctx, func() {
+		connectTimer.Stop()
+		firstByteTimer.Stop()
+		totalTimer.Stop()
+	})
+	// the upstream clients call this once the response body is closed or the request failed,
+	// background callers have no parent that would end and free the timers otherwise
+	ctx = context.WithValue(ctx, releaseKey{}, func() {
+		cancel(errUpstreamReleased)
+	})
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			connectTimer.Stop()
+		},
+		GotFirstResponseByte: func() {
+			firstByteTimer.Stop()
+		},
+	})
+
+	return http.NewRequestWithContext(ctx, method, url, body)
+}
+
+type stopper interface {
+	Stop() bool
+}
+
+type noopTimer struct{}
+
+func (noopTimer) Stop() bool {
+	return false
+}
+
+func phaseTimer(cancel context.CancelCauseFunc, phase string, timeout time.Duration) stopper {
+	if timeout <= 0 {
+		return noopTimer{}
+	}
+	return time.AfterFunc(timeout, func() {
+		cancel(fmt.Errorf(upstreamTimeoutErrorMessage, phase, timeout))
+	})
+}
+
+// UpstreamCause explains why an upstream request failed, the timeout that hit instead of a bare "context canceled".
+func UpstreamCause(req *http.Request, err error) error {
+	if cause := context.Cause(req.Context()); cause != nil && !errors.Is(cause, errUpstreamReleased) {
+		return cause
+	}
+	return err
+}
+
+type releaseKey struct{}
+
+// errUpstreamReleased cancels a request that is done with, it is no reason for a failure.
+var errUpstreamReleased = errors.New("upstream request released")
+
+// doUpstream runs do and releases the context of a request made by NewUpstreamRequest when it is done with.
+func doUpstream(do func(*http.Request) (*http.Response, error), req *http.Request) (*http.Response, error) {
+	resp, err := do(req)
+	release, ok := req.Context().Value(releaseKey{}).(func())
+	if !ok {
+		return resp, err
+	}
+	if err != nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// upstreamClient and sessionClient release the requests they send, see doUpstream.
+type upstreamClient struct {
+	HttpClient
+}
+
+func (c upstreamClient) Do(req *http.Request) (*http.Response, error) {
+	return doUpstream(c.HttpClient.Do, req)
+}
+
+type sessionClient struct {
+	tls_client.HttpClient
+}
+
+func (c sessionClient) Do(req *http.Request) (*http.Response, error) {
+	return doUpstream(c.HttpClient.Do, req)
+}
@@ -0,0 +1,27 @@
+package validation
+
+const (
+	defaultMaxBodySize = 32 << 20 // 32 MiB, base64 images make chat requests large
+
+	parseJsonErrorMessage      = "failed to parse json request body"
+	bodyTooLargeErrorMessage   = "request body is larger than %d bytes"
+	missingParamErrorMessage   = "missing required parameter: '%s'"
+	invalidTypeErrorMessage    = "invalid type for '%s': expected %s"
+	invalidValueErrorMessage   = "invalid value for '%s': expected one of %s"
+	outOfRangeErrorMessage     = "invalid '%s': expected a value between %v and %v, got %v"
+	emptyArrayErrorMessage     = "invalid '%s': empty array, expected at least one element"
+	tooManyErrorMessage        = "invalid '%s': expected at most %d elements, got %d"
+	functionNameErrorMessage   = "invalid '%s': function names must match ^[a-zA-Z0-9_-]{1,64}$"
+	topLogprobsErrorMessage    = "invalid 'top_logprobs': logprobs must be true when top_logprobs is set"
+	streamOptionsErrorMessage  = "invalid 'stream_options': only allowed when stream is true"
+	bestOfErrorMessage         = "invalid 'best_of': must be greater than or equal to n"
+	missingContentErrorMessage = "invalid '%s': content is required unless the assistant message has tool_calls or function_call"
+)
+
+var (
+	roles            = []string{"system", "developer", "user", "assistant", "tool", "function"}
+	contentPartTypes = []string{"text", "image_url", "input_audio", "file", "refusal"}
+	toolChoices      = []string{"none", "auto", "required"}
+	responseFormats  = []string{"text", "json_object", "json_schema"}
+	encodingFormats  = []string{"float", "base64"}
+)
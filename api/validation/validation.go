@@ -0,0 +1,597 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+var functionNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// MaxBodySize is the largest request body accepted, set by MAX_REQUEST_BODY_SIZE in bytes.
+func MaxBodySize() int64 {
+	size, err := strconv.ParseInt(os.Getenv("MAX_REQUEST_BODY_SIZE"), 10, 64)
+	if err != nil || size <= 0 {
+		return defaultMaxBodySize
+	}
+	return size
+}
+
+func BodyTooLarge(size int64) *api.Error {
+	return api.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf(bodyTooLargeErrorMessage, size))
+}
+
+// ChatCompletions checks a /v1/chat/completions body against the OpenAI schema.
+func ChatCompletions(body []byte) *api.Error {
+	request, err := parse(body)
+	if err != nil {
+		return err
+	}
+
+	if err := requireString(request, "model"); err != nil {
+		return err
+	}
+	if err := checkMessages(request); err != nil {
+		return err
+	}
+
+	if err := checkSampling(request); err != nil {
+		return err
+	}
+	if err := checkInteger(request, "max_completion_tokens", 1, math.MaxInt32); err != nil {
+		return err
+	}
+	if err := checkBool(request, "logprobs"); err != nil {
+		return err
+	}
+	if err := checkInteger(request, "top_logprobs", 0, 20); err != nil {
+		return err
+	}
+	if present(request, "top_logprobs") && request["logprobs"] != true {
+		return invalid(topLogprobsErrorMessage, "top_logprobs")
+	}
+	if err := checkBool(request, "parallel_tool_calls"); err != nil {
+		return err
+	}
+	if err := checkStreamOptions(request); err != nil {
+		return err
+	}
+	if err := checkTools(request); err != nil {
+		return err
+	}
+	if err := checkToolChoice(request); err != nil {
+		return err
+	}
+	return checkResponseFormat(request)
+}
+
+// Completions checks a legacy /v1/completions body.
+func Completions(body []byte) *api.Error {
+	request, err := parse(body)
+	if err != nil {
+		return err
+	}
+
+	if err := requireString(request, "model"); err != nil {
+		return err
+	}
+	if present(request, "prompt") && !isPrompt(request["prompt"]) {
+		return invalidType("prompt", "a string, an array of strings, a token array or an array of token arrays")
+	}
+	if err := checkSampling(request); err != nil {
+		return err
+	}
+	if err := checkInteger(request, "logprobs", 0, 5); err != nil {
+		return err
+	}
+	if err := checkInteger(request, "best_of", 1, 20); err != nil {
+		return err
+	}
+	if bestOf, ok := request["best_of"].(float64); ok {
+		if n, ok := request["n"].(float64); ok && bestOf < n {
+			return invalid(bestOfErrorMessage, "best_of")
+		}
+	}
+	if err := checkBool(request, "echo"); err != nil {
+		return err
+	}
+	if err := checkString(request, "suffix"); err != nil {
+		return err
+	}
+	return checkStreamOptions(request)
+}
+
+// Embeddings checks a /v1/embeddings body.
+func Embeddings(body []byte) *api.Error {
+	request, err := parse(body)
+	if err != nil {
+		return err
+	}
+
+	if err := requireString(request, "model"); err != nil {
+		return err
+	}
+	input, ok := request["input"]
+	if !ok || input == nil {
+		return missing("input")
+	}
+	if !isPrompt(input) {
+		return invalidType("input", "a string, an array of strings, a token array or an array of token arrays")
+	}
+	if list, ok := input.([]interface{}); ok && len(list) == 0 {
+		return invalid(fmt.Sprintf(emptyArrayErrorMessage, "input"), "input")
+	}
+	if err := checkEnum(request, "encoding_format", encodingFormats); err != nil {
+		return err
+	}
+	if err := checkInteger(request, "dimensions", 1, math.MaxInt32); err != nil {
+		return err
+	}
+	return checkString(request, "user")
+}
+
+func parse(body []byte) (map[string]interface{}, *api.Error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil || request == nil {
+		return nil, api.NewError(http.StatusBadRequest, parseJsonErrorMessage)
+	}
+	return request, nil
+}
+
+func checkMessages(request map[string]interface{}) *api.Error {
+	if !present(request, "messages") {
+		// patsnap also accepts a single prompt in message
+		if message, ok := request["message"].(string); ok && message != "" {
+			return nil
+		}
+		return missing("messages")
+	}
+	messages, ok := request["messages"].([]interface{})
+	if !ok {
+		return invalidType("messages", "an array of message objects")
+	}
+	if len(messages) == 0 {
+		return invalid(fmt.Sprintf(emptyArrayErrorMessage, "messages"), "messages")
+	}
+	for i, message := range messages {
+		if err := checkMessage(message, fmt.Sprintf("messages[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkMessage(message interface{}, param string) *api.Error {
+	object, ok := message.(map[string]interface{})
+	if !ok {
+		return invalidType(param, "a message object")
+	}
+
+	role, ok := object["role"].(string)
+	if !ok {
+		if object["role"] == nil {
+			return missing(param + ".role")
+		}
+		return invalidType(param+".role", "a string")
+	}
+	if !contains(roles, role) {
+		return invalidValue(param+".role", roles)
+	}
+	if err := checkString(object, "name", param); err != nil {
+		return err
+	}
+
+	content, hasContent := object["content"]
+	if !hasContent || content == nil {
+		if role != "assistant" || (object["tool_calls"] == nil && object["function_call"] == nil) {
+			return invalid(fmt.Sprintf(missingContentErrorMessage, param+".content"), param+".content")
+		}
+	} else if err := checkContent(content, param+".content", role); err != nil {
+		return err
+	}
+
+	switch role {
+	case "tool":
+		if _, ok := object["tool_call_id"].(string); !ok {
+			return missing(param + ".tool_call_id")
+		}
+	case "assistant":
+		if toolCalls, ok := object["tool_calls"]; ok && toolCalls != nil {
+			return checkToolCalls(toolCalls, param+".tool_calls")
+		}
+	}
+	return nil
+}
+
+func checkContent(content interface{}, param string, role string) *api.Error {
+	switch content := content.(type) {
+	case string:
+		return nil
+	case []interface{}:
+		for i, part := range content {
+			if err := checkContentPart(part, fmt.Sprintf("%s[%d]", param, i), role); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return invalidType(param, "a string or an array of content parts")
+	}
+}
+
+func checkContentPart(part interface{}, param string, role string) *api.Error {
+	object, ok := part.(map[string]interface{})
+	if !ok {
+		return invalidType(param, "a content part object")
+	}
+
+	partType, ok := object["type"].(string)
+	if !ok {
+		return missing(param + ".type")
+	}
+	if !contains(contentPartTypes, partType) || (partType == "refusal" && role != "assistant") {
+		return invalidValue(param+".type", contentPartTypes)
+	}
+
+	switch partType {
+	case "text":
+		if _, ok := object["text"].(string); !ok {
+			return missing(param + ".text")
+		}
+	case "refusal":
+		if _, ok := object["refusal"].(string); !ok {
+			return missing(param + ".refusal")
+		}
+	case "image_url":
+		imageUrl, ok := object["image_url"].(map[string]interface{})
+		if !ok {
+			return invalidType(param+".image_url", "an object with a url")
+		}
+		if url, ok := imageUrl["url"].(string); !ok || url == "" {
+			return missing(param + ".image_url.url")
+		}
+		if err := checkEnum(imageUrl, "detail", []string{"auto", "low", "high"}, param+".image_url"); err != nil {
+			return err
+		}
+	case "input_audio":
+		inputAudio, ok := object["input_audio"].(map[string]interface{})
+		if !ok {
+			return invalidType(param+".input_audio", "an object with data and format")
+		}
+		if _, ok := inputAudio["data"].(string); !ok {
+			return missing(param + ".input_audio.data")
+		}
+		if _, ok := inputAudio["format"].(string); !ok {
+			return missing(param + ".input_audio.format")
+		}
+	case "file":
+		if _, ok := object["file"].(map[string]interface{}); !ok {
+			return invalidType(param+".file", "an object")
+		}
+	}
+	return nil
+}
+
+func checkToolCalls(toolCalls interface{}, param string) *api.Error {
+	list, ok := toolCalls.([]interface{})
+	if !ok {
+		return invalidType(param, "an array of tool calls")
+	}
+	for i, toolCall := range list {
+		itemParam := fmt.Sprintf("%s[%d]", param, i)
+		object, ok := toolCall.(map[string]interface{})
+		if !ok {
+			return invalidType(itemParam, "a tool call object")
+		}
+		if err := requireString(object, "id", itemParam); err != nil {
+			return err
+		}
+		function, ok := object["function"].(map[string]interface{})
+		if !ok {
+			return missing(itemParam + ".function")
+		}
+		if err := requireString(function, "name", itemParam+".function"); err != nil {
+			return err
+		}
+		if _, ok := function["arguments"].(string); !ok {
+			return invalidType(itemParam+".function.arguments", "a json encoded string")
+		}
+	}
+	return nil
+}
+
+func checkSampling(request map[string]interface{}) *api.Error {
+	checks := []*api.Error{
+		checkBool(request, "stream"),
+		checkNumber(request, "temperature", 0, 2),
+		checkNumber(request, "top_p", 0, 1),
+		checkNumber(request, "presence_penalty", -2, 2),
+		checkNumber(request, "frequency_penalty", -2, 2),
+		checkInteger(request, "max_tokens", 1, math.MaxInt32),
+		checkInteger(request, "n", 1, 128),
+		checkInteger(request, "seed", math.MinInt64, math.MaxInt64),
+		checkString(request, "user"),
+		checkStop(request),
+		checkLogitBias(request),
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkStop(request map[string]interface{}) *api.Error {
+	switch stop := request["stop"].(type) {
+	case nil, string:
+		return nil
+	case []interface{}:
+		if len(stop) > 4 {
+			return invalid(fmt.Sprintf(tooManyErrorMessage, "stop", 4, len(stop)), "stop")
+		}
+		for i, sequence := range stop {
+			if _, ok := sequence.(string); !ok {
+				return invalidType(fmt.Sprintf("stop[%d]", i), "a string")
+			}
+		}
+		return nil
+	default:
+		return invalidType("stop", "a string or an array of strings")
+	}
+}
+
+func checkLogitBias(request map[string]interface{}) *api.Error {
+	if !present(request, "logit_bias") {
+		return nil
+	}
+	logitBias, ok := request["logit_bias"].(map[string]interface{})
+	if !ok {
+		return invalidType("logit_bias", "an object mapping token ids to biases")
+	}
+	for token := range logitBias {
+		if err := checkNumber(logitBias, token, -100, 100, "logit_bias"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkStreamOptions(request map[string]interface{}) *api.Error {
+	if !present(request, "stream_options") {
+		return nil
+	}
+	streamOptions, ok := request["stream_options"].(map[string]interface{})
+	if !ok {
+		return invalidType("stream_options", "an object")
+	}
+	if request["stream"] != true {
+		return invalid(streamOptionsErrorMessage, "stream_options")
+	}
+	return checkBool(streamOptions, "include_usage", "stream_options")
+}
+
+func checkTools(request map[string]interface{}) *api.Error {
+	if !present(request, "tools") {
+		return nil
+	}
+	tools, ok := request["tools"].([]interface{})
+	if !ok {
+		return invalidType("tools", "an array of tool objects")
+	}
+	if len(tools) > 128 {
+		return invalid(fmt.Sprintf(tooManyErrorMessage, "tools", 128, len(tools)), "tools")
+	}
+	for i, tool := range tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		object, ok := tool.(map[string]interface{})
+		if !ok {
+			return invalidType(param, "a tool object")
+		}
+		if object["type"] != "function" {
+			return invalidValue(param+".type", []string{"function"})
+		}
+		function, ok := object["function"].(map[string]interface{})
+		if !ok {
+			return missing(param + ".function")
+		}
+		if err := checkFunctionName(function, param+".function"); err != nil {
+			return err
+		}
+		if err := checkString(function, "description", param+".function"); err != nil {
+			return err
+		}
+		if parameters, ok := function["parameters"]; ok && parameters != nil {
+			if _, ok := parameters.(map[string]interface{}); !ok {
+				return invalidType(param+".function.parameters", "a json schema object")
+			}
+		}
+		if err := checkBool(function, "strict", param+".function"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkToolChoice(request map[string]interface{}) *api.Error {
+	switch toolChoice := request["tool_choice"].(type) {
+	case nil:
+		return nil
+	case string:
+		if !contains(toolChoices, toolChoice) {
+			return invalidValue("tool_choice", toolChoices)
+		}
+		return nil
+	case map[string]interface{}:
+		if toolChoice["type"] != "function" {
+			return invalidValue("tool_choice.type", []string{"function"})
+		}
+		function, ok := toolChoice["function"].(map[string]interface{})
+		if !ok {
+			return missing("tool_choice.function")
+		}
+		return checkFunctionName(function, "tool_choice.function")
+	default:
+		return invalidType("tool_choice", "a string or an object")
+	}
+}
+
+func checkResponseFormat(request map[string]interface{}) *api.Error {
+	if !present(request, "response_format") {
+		return nil
+	}
+	responseFormat, ok := request["response_format"].(map[string]interface{})
+	if !ok {
+		return invalidType("response_format", "an object")
+	}
+	formatType, _ := responseFormat["type"].(string)
+	if !contains(responseFormats, formatType) {
+		return invalidValue("response_format.type", responseFormats)
+	}
+	if formatType != "json_schema" {
+		return nil
+	}
+	jsonSchema, ok := responseFormat["json_schema"].(map[string]interface{})
+	if !ok {
+		return missing("response_format.json_schema")
+	}
+	return checkFunctionName(jsonSchema, "response_format.json_schema")
+}
+
+func checkFunctionName(object map[string]interface{}, param string) *api.Error {
+	if err := requireString(object, "name", param); err != nil {
+		return err
+	}
+	if !functionNameRegexp.MatchString(object["name"].(string)) {
+		return invalid(fmt.Sprintf(functionNameErrorMessage, param+".name"), param+".name")
+	}
+	return nil
+}
+
+func isPrompt(prompt interface{}) bool {
+	switch prompt := prompt.(type) {
+	case string:
+		return true
+	case []interface{}:
+		for _, item := range prompt {
+			switch item := item.(type) {
+			case string, float64:
+			case []interface{}:
+				for _, token := range item {
+					if _, ok := token.(float64); !ok {
+						return false
+					}
+				}
+			default:
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func present(object map[string]interface{}, key string) bool {
+	value, ok := object[key]
+	return ok && value != nil
+}
+
+func requireString(object map[string]interface{}, key string, parent ...string) *api.Error {
+	param := join(parent, key)
+	if !present(object, key) {
+		return missing(param)
+	}
+	if value, ok := object[key].(string); !ok || value == "" {
+		return invalidType(param, "a non-empty string")
+	}
+	return nil
+}
+
+func checkString(object map[string]interface{}, key string, parent ...string) *api.Error {
+	if _, ok := object[key].(string); present(object, key) && !ok {
+		return invalidType(join(parent, key), "a string")
+	}
+	return nil
+}
+
+func checkBool(object map[string]interface{}, key string, parent ...string) *api.Error {
+	if _, ok := object[key].(bool); present(object, key) && !ok {
+		return invalidType(join(parent, key), "a boolean")
+	}
+	return nil
+}
+
+func checkEnum(object map[string]interface{}, key string, values []string, parent ...string) *api.Error {
+	if !present(object, key) {
+		return nil
+	}
+	if value, ok := object[key].(string); !ok || !contains(values, value) {
+		return invalidValue(join(parent, key), values)
+	}
+	return nil
+}
+
+func checkNumber(object map[string]interface{}, key string, min float64, max float64, parent ...string) *api.Error {
+	if !present(object, key) {
+		return nil
+	}
+	param := join(parent, key)
+	value, ok := object[key].(float64)
+	if !ok {
+		return invalidType(param, "a number")
+	}
+	if value < min || value > max {
+		return invalid(fmt.Sprintf(outOfRangeErrorMessage, param, min, max, value), param)
+	}
+	return nil
+}
+
+func checkInteger(object map[string]interface{}, key string, min float64, max float64, parent ...string) *api.Error {
+	if !present(object, key) {
+		return nil
+	}
+	if value, ok := object[key].(float64); !ok || value != math.Trunc(value) {
+		return invalidType(join(parent, key), "an integer")
+	}
+	return checkNumber(object, key, min, max, parent...)
+}
+
+func join(parent []string, key string) string {
+	if len(parent) == 0 {
+		return key
+	}
+	return parent[0] + "." + key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func invalid(message string, param string) *api.Error {
+	return api.NewParamError(http.StatusBadRequest, message, param)
+}
+
+func missing(param string) *api.Error {
+	return invalid(fmt.Sprintf(missingParamErrorMessage, param), param)
+}
+
+func invalidType(param string, expected string) *api.Error {
+	return invalid(fmt.Sprintf(invalidTypeErrorMessage, param, expected), param)
+}
+
+func invalidValue(param string, values []string) *api.Error {
+	return invalid(fmt.Sprintf(invalidValueErrorMessage, param, "'"+strings.Join(values, "', '")+"'"), param)
+}
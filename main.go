@@ -1,22 +1,44 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	http "github.com/bogdanfinn/fhttp"
 	"github.com/gin-gonic/gin"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/backend"
 	"github.com/dhso/go-chatgpt-api/api/chatgpt"
 	"github.com/dhso/go-chatgpt-api/api/copilot"
+	"github.com/dhso/go-chatgpt-api/api/embeddings"
+	"github.com/dhso/go-chatgpt-api/api/gemini"
+	"github.com/dhso/go-chatgpt-api/api/health"
 	"github.com/dhso/go-chatgpt-api/api/imitate"
+	"github.com/dhso/go-chatgpt-api/api/metrics"
+	"github.com/dhso/go-chatgpt-api/api/ollama"
 	"github.com/dhso/go-chatgpt-api/api/patgpt"
 	"github.com/dhso/go-chatgpt-api/api/patgpt_new"
 	"github.com/dhso/go-chatgpt-api/api/platform"
+	"github.com/dhso/go-chatgpt-api/api/responses"
+	"github.com/dhso/go-chatgpt-api/api/session"
+	"github.com/dhso/go-chatgpt-api/api/validation"
 	_ "github.com/dhso/go-chatgpt-api/env"
 	"github.com/dhso/go-chatgpt-api/middleware"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	// time given to the cancelled handlers to write their final error event
+	shutdownGracePeriod = 5 * time.Second
 )
 
 func init() {
@@ -26,8 +48,12 @@ func init() {
 
 func main() {
 	log.Printf("version: %s", api.Version)
-	router := gin.Default()
+	router := gin.New()
 
+	router.Use(gin.Logger())
+	router.Use(middleware.RequestId())
+	router.Use(middleware.Recovery())
+	router.Use(middleware.Drain())
 	router.Use(middleware.CORS())
 	router.Use(middleware.Authorization())
 
@@ -38,19 +64,64 @@ func main() {
 	setupPatgptNewAPIs(router)
 	setupPatgptAPIs(router)
 	setupCopilotAPIs(router)
+	setupBackends()
+	setupGeminiAPIs(router)
+	setupResponsesAPIs(router)
+	setupAdminAPIs(router)
 	router.NoRoute(api.Proxy)
 
 	router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, api.ReadyHint)
 	})
+	router.GET("/healthz", health.Healthz)
+	router.GET("/readyz", health.Readyz)
+	health.Start()
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	err := router.Run(":" + port)
-	if err != nil {
-		log.Fatal("failed to start server: " + err.Error())
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("failed to start server: " + err.Error())
+		}
+	}()
+	logger.Info(api.ReadyHint)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	shutdown(server)
+}
+
+// shutdown stops accepting requests and lets the active ones finish within SHUTDOWN_TIMEOUT,
+// streams still open after that end with an error event.
+func shutdown(server *http.Server) {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	logger.Info(fmt.Sprintf("shutting down, waiting up to %s for active requests", timeout))
+
+	middleware.BeginDrain()
+	// nothing calls upstream in the background while draining
+	health.Stop()
+	session.DefaultStore.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		if !middleware.CancelActive(shutdownGracePeriod) {
+			logger.Warn("some requests did not finish in time")
+		}
+		server.Close()
+	}
+
+	if err := embeddings.DefaultCache.Close(); err != nil {
+		logger.Warn("failed to flush embedding cache: " + err.Error())
 	}
 }
 
@@ -58,11 +129,21 @@ func setupChatGPTAPIs(router *gin.Engine) {
 	chatgptGroup := router.Group("/chatgpt")
 	{
 		chatgptGroup.POST("/login", chatgpt.Login)
+		chatgptGroup.POST("/logout", session.Logout)
 		chatgptGroup.POST("/backend-api/login", chatgpt.Login) // add support for other projects
 
+		chatgptGroup.GET("/backend-api/conversations", chatgpt.GetConversations)
+		chatgptGroup.PATCH("/backend-api/conversations", chatgpt.UpdateConversations)
+		chatgptGroup.GET("/conversations/:id/export", chatgpt.ExportConversation)
+		chatgptGroup.POST("/attachments", chatgpt.UploadAttachment)
+
 		conversationGroup := chatgptGroup.Group("/backend-api/conversation")
 		{
 			conversationGroup.POST("", chatgpt.CreateConversation)
+			conversationGroup.GET("/:id", chatgpt.GetConversation)
+			conversationGroup.PATCH("/:id", chatgpt.UpdateConversation)
+			conversationGroup.POST("/gen_title/:id", chatgpt.GenerateTitle)
+			conversationGroup.POST("/:id/share", chatgpt.ShareConversation)
 		}
 	}
 }
@@ -71,19 +152,27 @@ func setupPlatformAPIs(router *gin.Engine) {
 	platformGroup := router.Group("/platform")
 	{
 		platformGroup.POST("/login", platform.Login)
+		platformGroup.POST("/logout", session.Logout)
 		platformGroup.POST("/v1/login", platform.Login)
 
 		apiGroup := platformGroup.Group("/v1")
 		{
-			apiGroup.POST("/chat/completions", platform.CreateChatCompletions)
-			apiGroup.POST("/completions", platform.CreateCompletions)
+			apiGroup.POST("/chat/completions", middleware.Validate(validation.ChatCompletions), platform.CreateChatCompletions)
+			apiGroup.POST("/completions", middleware.Validate(validation.Completions), platform.CreateCompletions)
+			apiGroup.POST("/embeddings", middleware.Validate(validation.Embeddings), platform.CreateEmbeddings)
 		}
 	}
 }
 
 func setupPandoraAPIs(router *gin.Engine) {
 	router.Any("/api/*path", func(c *gin.Context) {
-		c.Request.URL.Path = strings.ReplaceAll(c.Request.URL.Path, "/api", "/chatgpt/backend-api")
+		// ollama shares the /api prefix, gin does not allow static routes next to the catch-all one
+		if handler, ok := ollama.Routes[c.Request.Method+" "+c.Request.URL.Path]; ok {
+			handler(c)
+			return
+		}
+
+		c.Request.URL.Path = strings.Replace(c.Request.URL.Path, "/api", "/chatgpt/backend-api", 1)
 		router.HandleContext(c)
 	})
 }
@@ -92,10 +181,12 @@ func setupImitateAPIs(router *gin.Engine) {
 	imitateGroup := router.Group("/imitate")
 	{
 		imitateGroup.POST("/login", chatgpt.Login)
+		imitateGroup.POST("/logout", session.Logout)
 
 		apiGroup := imitateGroup.Group("/v1")
 		{
-			apiGroup.POST("/chat/completions", imitate.CreateChatCompletions)
+			apiGroup.POST("/chat/completions", middleware.Validate(validation.ChatCompletions), imitate.CreateChatCompletions)
+			apiGroup.POST("/images/generations", imitate.CreateImages)
 		}
 	}
 }
@@ -105,9 +196,9 @@ func setupPatgptAPIs(router *gin.Engine) {
 	{
 		apiGroup := patgptGroup.Group("/v1")
 		{
-			apiGroup.POST("/chat/completions", patgpt.CreateChatCompletions)
-			apiGroup.POST("/completions", patgpt.CreateCompletions)
-			apiGroup.POST("/embeddings", patgpt.CreateEmbeddings)
+			apiGroup.POST("/chat/completions", middleware.Validate(validation.ChatCompletions), patgpt.CreateChatCompletions)
+			apiGroup.POST("/completions", middleware.Validate(validation.Completions), patgpt.CreateCompletions)
+			apiGroup.POST("/embeddings", middleware.Validate(validation.Embeddings), patgpt.CreateEmbeddings)
 			apiGroup.GET("/dashboard/billing/subscription", patgpt.GetBillingSubscription)
 			apiGroup.GET("/dashboard/billing/usage", patgpt.GetBillingUsage)
 		}
@@ -119,9 +210,9 @@ func setupPatgptNewAPIs(router *gin.Engine) {
 	{
 		apiGroup := patgptNewGroup.Group("/v1")
 		{
-			apiGroup.POST("/chat/completions", patgpt_new.CreateChatCompletions)
-			apiGroup.POST("/completions", patgpt_new.CreateCompletions)
-			apiGroup.POST("/embeddings", patgpt_new.CreateEmbeddings)
+			apiGroup.POST("/chat/completions", middleware.Validate(validation.ChatCompletions), patgpt_new.CreateChatCompletions)
+			apiGroup.POST("/completions", middleware.Validate(validation.Completions), patgpt_new.CreateCompletions)
+			apiGroup.POST("/embeddings", middleware.Validate(validation.Embeddings), patgpt_new.CreateEmbeddings)
 			apiGroup.GET("/dashboard/billing/subscription", patgpt_new.GetBillingSubscription)
 			apiGroup.GET("/dashboard/billing/usage", patgpt_new.GetBillingUsage)
 		}
@@ -133,8 +224,64 @@ func setupCopilotAPIs(router *gin.Engine) {
 	{
 		apiGroup := copilotGroup.Group("/v1")
 		{
-			apiGroup.POST("/chat/completions", copilot.CreateChatCompletions)
-			apiGroup.POST("/completions", copilot.CreateCompletions)
+			apiGroup.POST("/chat/completions", middleware.Validate(validation.ChatCompletions), copilot.CreateChatCompletions)
+			apiGroup.POST("/completions", middleware.Validate(validation.Completions), copilot.CreateCompletions)
 		}
 	}
 }
+
+func setupBackends() {
+	backend.Register("platform", platform.CreateChatCompletions)
+	backend.Register("imitate", imitate.CreateChatCompletions)
+	backend.Register("patgpt", patgpt.CreateChatCompletions)
+	backend.Register("patgpt_new", patgpt_new.CreateChatCompletions)
+	backend.Register("copilot", copilot.CreateChatCompletions)
+
+	backend.RegisterEmbeddings("platform", platform.CreateEmbeddings)
+	backend.RegisterEmbeddings("patgpt", patgpt.CreateEmbeddings)
+	backend.RegisterEmbeddings("patgpt_new", patgpt_new.CreateEmbeddings)
+}
+
+func setupGeminiAPIs(router *gin.Engine) {
+	geminiGroup := router.Group("/gemini")
+	{
+		apiGroup := geminiGroup.Group("/v1beta")
+		{
+			apiGroup.POST("/models/:model", gemini.GenerateContent)
+		}
+	}
+}
+
+func setupResponsesAPIs(router *gin.Engine) {
+	apiGroup := router.Group("/v1")
+	{
+		apiGroup.POST("/responses", responses.CreateResponse)
+		apiGroup.GET("/responses/:id", responses.GetResponse)
+		apiGroup.DELETE("/responses/:id", responses.DeleteResponse)
+	}
+}
+
+func setupAdminAPIs(router *gin.Engine) {
+	adminGroup := router.Group("/admin", middleware.Admin())
+	{
+		adminGroup.GET("/embeddings/cache", embeddings.GetCacheStats)
+		adminGroup.DELETE("/embeddings/cache", embeddings.ClearCache)
+		adminGroup.GET("/metrics", metrics.GetMetrics)
+		adminGroup.GET("/arkose", api.GetArkoseStatus)
+		adminGroup.POST("/arkose/tokens", api.AddArkoseTokens)
+
+		adminGroup.GET("/accounts", api.GetPUIDStatus)
+		adminGroup.POST("/accounts", api.AddPUIDAccount)
+		adminGroup.PATCH("/accounts/:email", api.UpdatePUIDAccount)
+		adminGroup.POST("/accounts/:email/refresh", api.RefreshPUIDAccount)
+
+		adminGroup.GET("/keys", session.ListSessions)
+		adminGroup.POST("/keys", session.ImportSession)
+		adminGroup.PATCH("/keys/:key", session.UpdateSession)
+		adminGroup.DELETE("/keys/:key", session.DeleteSession)
+		adminGroup.POST("/keys/:key/refresh", session.RefreshSession)
+
+		adminGroup.GET("/copilot/tokens", copilot.GetCachedTokens)
+		adminGroup.DELETE("/copilot/tokens", copilot.ClearCachedTokens)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+const (
+	adminDisabledErrorMessage = "admin api is disabled, set ADMIN_TOKEN to enable it"
+	adminTokenErrorMessage    = "invalid admin token"
+)
+
+// Admin guards the /admin routes with the ADMIN_TOKEN environment variable.
+func Admin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			api.AbortWithError(c, http.StatusForbidden, adminDisabledErrorMessage)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(api.GetBearerRemovedToken(c)), []byte(adminToken)) != 1 {
+			api.AbortWithError(c, http.StatusUnauthorized, adminTokenErrorMessage)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,54 +1,46 @@
 package middleware
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/jwt"
+	"github.com/dhso/go-chatgpt-api/api/ollama"
+	"github.com/dhso/go-chatgpt-api/api/session"
 )
 
 const (
-	emptyAccessTokenErrorMessage      = "please provide a valid access token or api key in 'Authorization' header"
-	accessTokenHasExpiredErrorMessage = "the accessToken for account %s has expired"
+	emptyAccessTokenErrorMessage = "please provide a valid access token or api key in 'Authorization' header"
+	sessionNotFoundErrorMessage  = "the session has expired or does not exist, please login again"
 )
 
-type AccessToken struct {
-	HTTPSAPIOpenaiComProfile struct {
-		Email         string `json:"email"`
-		EmailVerified bool   `json:"email_verified"`
-	} `json:"https://api.openai.com/profile"`
-	HTTPSAPIOpenaiComAuth struct {
-		UserID string `json:"user_id"`
-	} `json:"https://api.openai.com/auth"`
-	Iss    string   `json:"iss"`
-	Sub    string   `json:"sub"`
-	Aud    []string `json:"aud"`
-	Iat    int      `json:"iat"`
-	Exp    int      `json:"exp"`
-	Azp    string   `json:"azp"`
-	Scope  string   `json:"scope"`
-	Object string   `json:"object"`
-	Header string   `json:"header"`
-}
-
 func Authorization() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authorization := c.GetHeader(api.AuthorizationHeader)
 		if authorization == "" {
 			authorization = c.GetHeader(api.XAuthorizationHeader)
 		}
+		if authorization == "" && strings.HasPrefix(c.Request.URL.Path, "/gemini") {
+			// google sdks send the key in x-goog-api-key or ?key=
+			authorization = c.GetHeader(api.XGoogApiKeyHeader)
+			if authorization == "" {
+				authorization = c.Query("key")
+			}
+		}
+		if authorization == "" && ollama.Paths[c.Request.URL.Path] {
+			// ollama clients usually do not send credentials at all
+			authorization = os.Getenv("OLLAMA_ACCESS_TOKEN")
+		}
 
 		if authorization == "" {
 			if c.Request.URL.Path == "/" {
 				c.Header("Content-Type", "text/plain")
-			} else if strings.HasSuffix(c.Request.URL.Path, "/login") ||
+			} else if c.Request.URL.Path == "/healthz" || c.Request.URL.Path == "/readyz" ||
+				strings.HasSuffix(c.Request.URL.Path, "/login") ||
 				strings.HasPrefix(c.Request.URL.Path, "/chatgpt/public-api") ||
 				(strings.HasPrefix(c.Request.URL.Path, "/imitate") && os.Getenv("IMITATE_ACCESS_TOKEN") != "") {
 				c.Header("Content-Type", "application/json")
@@ -56,42 +48,38 @@ func Authorization() gin.HandlerFunc {
 				c.Abort()
 				return
 			} else {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(emptyAccessTokenErrorMessage))
+				api.AbortWithError(c, http.StatusUnauthorized, emptyAccessTokenErrorMessage)
 				return
 			}
 
 			c.Next()
 		} else {
-			if expired := isExpired(c); expired {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(fmt.Sprintf(accessTokenHasExpiredErrorMessage, c.GetString(api.EmailKey))))
-				return
-			}
-
-			c.Set(api.AuthorizationHeader, authorization)
-		}
-	}
-}
+			if key := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")); session.IsKey(key) {
+				s, ok := session.DefaultStore.Get(c.Request.Context(), key)
+				if !ok {
+					api.AbortWithError(c, http.StatusUnauthorized, sessionNotFoundErrorMessage)
+					return
+				}
 
-func isExpired(c *gin.Context) bool {
-	accessToken := c.GetHeader(api.AuthorizationHeader)
-	split := strings.Split(accessToken, ".")
-	if len(split) == 3 {
-		rawDecodedText, _ := base64.RawStdEncoding.DecodeString(split[1])
-		var accessToken AccessToken
-		json.Unmarshal(rawDecodedText, &accessToken)
-		if accessToken.Header == "X-Credential-Username" {
-			return false
-		}
+				// handlers and the proxy read the header directly, so swap in the current access token
+				authorization = "Bearer " + s.AccessToken
+				c.Request.Header.Set(api.AuthorizationHeader, authorization)
+				c.Set(session.KeyContextKey, key)
+			}
 
-		c.Set(api.EmailKey, accessToken.HTTPSAPIOpenaiComProfile.Email)
+			if token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")); jwt.IsJWT(token) {
+				t, err := jwt.Inspect(token)
+				if err != nil {
+					api.AbortWithError(c, http.StatusUnauthorized, err.Error())
+					return
+				}
 
-		exp := int64(accessToken.Exp)
-		expTime := time.Unix(exp, 0)
-		now := time.Now()
+				identity := t.Identity()
+				c.Set(api.EmailKey, identity.Email)
+				c.Set(jwt.IdentityKey, identity)
+			}
 
-		return now.After(expTime)
+			c.Set(api.AuthorizationHeader, authorization)
+		}
 	}
-
-	// apiKey
-	return false
 }
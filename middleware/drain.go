@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	shuttingDownErrorMessage = "the server is shutting down, please try again"
+)
+
+var (
+	errShuttingDown = errors.New(shuttingDownErrorMessage)
+
+	draining atomic.Bool
+	active   sync.WaitGroup
+	cancels  = map[*gin.Context]context.CancelCauseFunc{}
+	cancelMu sync.Mutex
+
+	terminalMarkers = [][]byte{
+		[]byte("data: [DONE]"),
+		[]byte(`data: {"error"`),
+		[]byte("event: response.completed"),
+		[]byte("event: response.failed"),
+		[]byte(`"done":true`),
+	}
+)
+
+// Drain tracks in-flight requests so that a shutdown can wait for them, and refuses new ones while draining.
+func Drain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if draining.Load() {
+			c.Header("Connection", "close")
+			api.AbortWithError(c, http.StatusServiceUnavailable, shuttingDownErrorMessage)
+			return
+		}
+
+		ctx, cancel := context.WithCancelCause(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		active.Add(1)
+		cancelMu.Lock()
+		cancels[c] = cancel
+		cancelMu.Unlock()
+		defer func() {
+			cancelMu.Lock()
+			delete(cancels, c)
+			cancelMu.Unlock()
+			cancel(nil)
+			active.Done()
+		}()
+
+		writer := &terminalWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		if errors.Is(context.Cause(ctx), errShuttingDown) && !writer.terminated {
+			// ends the stream with an error event instead of a silently truncated answer
+			if c.Writer.Written() && strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "application/x-ndjson") {
+				logger.Warn(shuttingDownErrorMessage)
+				data, _ := json.Marshal(gin.H{"error": shuttingDownErrorMessage, "done": true})
+				c.Writer.Write(append(data, '\n'))
+				c.Writer.Flush()
+				c.Abort()
+				return
+			}
+			api.AbortWithError(c, http.StatusServiceUnavailable, shuttingDownErrorMessage)
+		}
+	}
+}
+
+// terminalWriter remembers whether the last write ended the response, so that a shutdown does not add
+// a second error event, or one after the end of the stream.
+type terminalWriter struct {
+	gin.ResponseWriter
+	terminated bool
+}
+
+func (w *terminalWriter) Write(data []byte) (int, error) {
+	w.terminated = isTerminal(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *terminalWriter) WriteString(s string) (int, error) {
+	w.terminated = isTerminal([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// isTerminal matches the last event of the SSE and NDJSON streams: [DONE], an error event,
+// the final responses api event, and the ollama error or done line.
+func isTerminal(data []byte) bool {
+	for _, marker := range terminalMarkers {
+		if bytes.Contains(data, marker) {
+			return true
+		}
+	}
+	return bytes.HasPrefix(data, []byte(`{"error"`))
+}
+
+// BeginDrain makes Drain refuse new requests.
+func BeginDrain() {
+	draining.Store(true)
+}
+
+// CancelActive cancels the context of every in-flight request and waits up to timeout for their handlers to return.
+func CancelActive(timeout time.Duration) bool {
+	cancelMu.Lock()
+	for _, cancel := range cancels {
+		cancel(errShuttingDown)
+	}
+	cancelMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/metrics"
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	panicRecoveredLogMessage = "panic recovered, request id: %s, %s %s: %v\n%s"
+	internalErrorMessage     = "internal server error, request id: %s"
+)
+
+// Recovery replaces gin's recovery, panics are reported as OpenAI errors instead of an empty 500.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			requestId := c.GetString(api.RequestIdKey)
+			metrics.Inc(metrics.PanicsRecovered)
+			logger.Error(fmt.Sprintf(panicRecoveredLogMessage, requestId, c.Request.Method, c.Request.URL.Path, recovered, debug.Stack()))
+
+			if isBrokenPipe(recovered) {
+				// the client is gone, nothing can be written
+				c.Abort()
+				return
+			}
+
+			api.AbortWithError(c, http.StatusInternalServerError, fmt.Sprintf(internalErrorMessage, requestId))
+		}()
+
+		c.Next()
+	}
+}
+
+func isBrokenPipe(recovered any) bool {
+	err, ok := recovered.(error)
+	if !ok {
+		return false
+	}
+
+	var opError *net.OpError
+	if !errors.As(err, &opError) {
+		return false
+	}
+	var syscallError *os.SyscallError
+	if !errors.As(opError, &syscallError) {
+		return false
+	}
+	message := strings.ToLower(syscallError.Error())
+	return strings.Contains(message, "broken pipe") || strings.Contains(message, "connection reset by peer")
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/dhso/go-chatgpt-api/api"
+)
+
+// RequestId reuses the caller's X-Request-Id or generates one, and echoes it back.
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(api.XRequestIdHeader)
+		if requestId == "" || len(requestId) > 128 {
+			requestId = uuid.NewString()
+		}
+
+		c.Set(api.RequestIdKey, requestId)
+		c.Header(api.XRequestIdHeader, requestId)
+		c.Next()
+	}
+}
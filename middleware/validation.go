@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhso/go-chatgpt-api/api"
+	"github.com/dhso/go-chatgpt-api/api/validation"
+)
+
+// Validate rejects oversized or malformed request bodies before they are dispatched upstream.
+func Validate(validate func(body []byte) *api.Error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxBodySize := validation.MaxBodySize()
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize+1))
+		if err != nil {
+			api.AbortWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if int64(len(body)) > maxBodySize {
+			api.Abort(c, http.StatusRequestEntityTooLarge, validation.BodyTooLarge(maxBodySize))
+			return
+		}
+
+		if err := validate(body); err != nil {
+			api.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}